@@ -0,0 +1,120 @@
+package rincon
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Balancer picks one instance of a service to send a request to.
+type Balancer interface {
+	// Pick returns one of the given instances, which all belong to the
+	// same service. The key identifies the request for balancers that
+	// route it consistently, and may be empty.
+	Pick(instances []Service, key string) (*Service, error)
+}
+
+// NewestVersionBalancer is a Balancer that round robins between the
+// instances with the newest Version. It is the default Balancer.
+type NewestVersionBalancer struct {
+	next atomic.Uint64
+}
+
+// Pick implements Balancer.
+func (b *NewestVersionBalancer) Pick(instances []Service, key string) (*Service, error) {
+	newest := newestInstances(instances)
+	if len(newest) == 0 {
+		return nil, ErrNoInstances
+	}
+	i := b.next.Add(1) - 1
+	return &newest[i%uint64(len(newest))], nil
+}
+
+// newestInstances returns the instances that share the newest version.
+// Instances with an invalid version are only returned if no instance has
+// a valid one.
+func newestInstances(instances []Service) []Service {
+	sorted := append([]Service(nil), instances...)
+	SortServicesByVersion(sorted)
+	for i := 1; i < len(sorted); i++ {
+		if compareServiceVersions(sorted[0], sorted[i]) != 0 {
+			return sorted[:i]
+		}
+	}
+	return sorted
+}
+
+// compareServiceVersions compares the versions of two services, treating
+// an invalid version as older than any valid one.
+func compareServiceVersions(a, b Service) int {
+	va, errA := ParseVersion(a.Version)
+	vb, errB := ParseVersion(b.Version)
+	switch {
+	case errA != nil && errB != nil:
+		return 0
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	return va.Compare(vb)
+}
+
+// PickService returns one instance of the named service chosen by the
+// client's Balancer. The key identifies the request for balancers that
+// route it consistently, and may be empty. Version constraints are applied
+// as in GetServicesByName, and instances ejected by the health prober or
+// whose circuit breaker is open are skipped.
+func (c *Client) PickService(name string, key string, constraints ...string) (*Service, error) {
+	return c.PickServiceContext(context.Background(), name, key, constraints...)
+}
+
+// PickServiceContext is like PickService, but looks up the instances with
+// GetServicesByNameContext.
+func (c *Client) PickServiceContext(ctx context.Context, name string, key string, constraints ...string) (*Service, error) {
+	instances, err := c.GetServicesByNameContext(ctx, name, constraints...)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]Service, 0, len(instances))
+	for _, instance := range c.healthyInstances(instances) {
+		if c.available(instance) {
+			candidates = append(candidates, instance)
+		}
+	}
+	if len(candidates) == 0 && len(instances) > 0 {
+		c.instrumentation.BalancerPick(name, nil, ErrCircuitOpen)
+		return nil, ErrCircuitOpen
+	}
+	service, count, err := c.balance(candidates, key)
+	if err == nil {
+		count()
+	}
+	c.instrumentation.BalancerPick(name, service, err)
+	return service, err
+}
+
+// balance picks one of the instances with the client's Balancer. The
+// returned function counts the pick in the Stats of a WeightedBalancer,
+// and is called once the instance is known to receive the request.
+func (c *Client) balance(instances []Service, key string) (*Service, func(), error) {
+	if weighted, ok := c.balancer.(*WeightedBalancer); ok {
+		return weighted.pick(instances, key)
+	}
+	return uncounted(c.balancer.Pick(instances, key))
+}
+
+// localServices returns the instances of the named service from the
+// current snapshot, without marking them as stale.
+func (c *Client) localServices(name string) []Service {
+	snapshot := c.currentSnapshot()
+	if snapshot == nil {
+		return nil
+	}
+	services := make([]Service, 0)
+	for _, service := range snapshot.Services {
+		if service.Name == name {
+			services = append(services, service)
+		}
+	}
+	return services
+}
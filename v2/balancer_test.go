@@ -0,0 +1,54 @@
+package rincon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewestVersionBalancer(t *testing.T) {
+	instances := []Service{
+		{ID: 1, Name: "orders", Version: "1.9.0"},
+		{ID: 2, Name: "orders", Version: "2.0.0"},
+		{ID: 3, Name: "orders", Version: "latest"},
+		{ID: 4, Name: "orders", Version: "2.0.0"},
+	}
+	b := &NewestVersionBalancer{}
+	picks := make(map[int]int)
+	for i := 0; i < 10; i++ {
+		service, err := b.Pick(instances, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		picks[service.ID]++
+	}
+	if len(picks) != 2 || picks[2] != 5 || picks[4] != 5 {
+		t.Fatalf("picks = %v, want an even round robin of 2 and 4", picks)
+	}
+
+	service, err := b.Pick([]Service{{ID: 5, Version: "latest"}}, "")
+	if err != nil || service.ID != 5 {
+		t.Fatalf("invalid versions only: got %v, %v", service, err)
+	}
+	if _, err := b.Pick(nil, ""); !errors.Is(err, ErrNoInstances) {
+		t.Fatalf("no instances: err = %v, want ErrNoInstances", err)
+	}
+}
+
+func TestPickServiceWithConstraints(t *testing.T) {
+	f := newFakeRincon(t)
+	f.add(Service{Name: "orders", Version: "1.4.0", Endpoint: "http://orders-1:8080"})
+	f.add(Service{Name: "orders", Version: "2.1.0", Endpoint: "http://orders-2:8080"})
+	client := newTestClient(t, f, Config{})
+
+	service, err := client.PickService("orders", "")
+	if err != nil || service.Version != "2.1.0" {
+		t.Fatalf("PickService = %v, %v; want version 2.1.0", service, err)
+	}
+	service, err = client.PickService("orders", "", "^1")
+	if err != nil || service.Version != "1.4.0" {
+		t.Fatalf("PickService(^1) = %v, %v; want version 1.4.0", service, err)
+	}
+	if _, err := client.PickService("orders", "", ">=3"); !errors.Is(err, ErrNoInstances) {
+		t.Fatalf("PickService(>=3): err = %v, want ErrNoInstances", err)
+	}
+}
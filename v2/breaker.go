@@ -0,0 +1,261 @@
+package rincon
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of the circuit breaker of a service instance.
+type BreakerState int32
+
+const (
+	// BreakerClosed lets every request through while counting failures.
+	BreakerClosed BreakerState = 0
+	// BreakerOpen rejects requests until the open duration has passed.
+	BreakerOpen BreakerState = 1
+	// BreakerHalfOpen lets a single trial request through, which closes
+	// the breaker if it succeeds and opens it again if it fails.
+	BreakerHalfOpen BreakerState = 2
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// BreakerStatus is the state of the circuit breaker of a service instance.
+type BreakerStatus struct {
+	ID       int          `json:"id"`
+	Name     string       `json:"name"`
+	Endpoint string       `json:"endpoint"`
+	State    BreakerState `json:"state"`
+	// Requests and Failures are counted in the current window while the
+	// breaker is closed.
+	Requests int       `json:"requests"`
+	Failures int       `json:"failures"`
+	OpenedAt time.Time `json:"opened_at"`
+}
+
+// breaker is the circuit breaker of one service instance.
+type breaker struct {
+	status      BreakerStatus
+	windowStart time.Time
+	trialAt     time.Time
+}
+
+// stateChange is a breaker transition to report to OnBreakerStateChange.
+type stateChange struct {
+	service  Service
+	from, to BreakerState
+}
+
+// breakers holds the circuit breakers of every instance the client has
+// sent requests to, keyed by Service.ID.
+type breakers struct {
+	mu sync.Mutex
+	m  map[int]*breaker
+}
+
+// breakersEnabled reports whether the client was configured with a
+// BreakerFailureRate.
+func (c *Client) breakersEnabled() bool {
+	return c.breakerFailureRate > 0
+}
+
+// get returns the breaker of the service, creating a closed one if needed.
+// The caller must hold the lock.
+func (b *breakers) get(service Service, now time.Time) *breaker {
+	if b.m == nil {
+		b.m = make(map[int]*breaker)
+	}
+	br, ok := b.m[service.ID]
+	if !ok || br.status.Endpoint != service.Endpoint {
+		br = &breaker{
+			status: BreakerStatus{
+				ID:       service.ID,
+				Name:     service.Name,
+				Endpoint: service.Endpoint,
+			},
+			windowStart: now,
+		}
+		b.m[service.ID] = br
+	}
+	return br
+}
+
+// available reports whether the breaker of the service may let a request
+// through, without claiming the half-open trial.
+func (c *Client) available(service Service) bool {
+	if !c.breakersEnabled() {
+		return true
+	}
+	now := time.Now()
+	c.breakers.mu.Lock()
+	defer c.breakers.mu.Unlock()
+	br, ok := c.breakers.m[service.ID]
+	if !ok {
+		return true
+	}
+	switch br.status.State {
+	case BreakerOpen:
+		return !now.Before(br.status.OpenedAt.Add(c.breakerOpenDuration))
+	case BreakerHalfOpen:
+		return br.trialAt.IsZero()
+	}
+	return true
+}
+
+// allow reports whether a request may be sent to the service, and claims
+// the trial request when the breaker is half-open. A trial that is not
+// reported within the open duration is given up on, so that a lost result
+// cannot keep the breaker half-open forever.
+func (c *Client) allow(service Service) bool {
+	if !c.breakersEnabled() {
+		return true
+	}
+	now := time.Now()
+	var change *stateChange
+	c.breakers.mu.Lock()
+	br := c.breakers.get(service, now)
+	allowed := true
+	switch br.status.State {
+	case BreakerOpen:
+		if now.Before(br.status.OpenedAt.Add(c.breakerOpenDuration)) {
+			allowed = false
+			break
+		}
+		br.status.State = BreakerHalfOpen
+		br.trialAt = now
+		change = &stateChange{service: service, from: BreakerOpen, to: BreakerHalfOpen}
+	case BreakerHalfOpen:
+		if !br.trialAt.IsZero() && now.Before(br.trialAt.Add(c.breakerOpenDuration)) {
+			allowed = false
+			break
+		}
+		br.trialAt = now
+	}
+	c.breakers.mu.Unlock()
+	c.fireBreakerChange(change)
+	return allowed
+}
+
+// recordResult counts the outcome of a request to the service. Errors and
+// 5xx responses are failures, except when the caller canceled the request.
+func (c *Client) recordResult(service Service, status int, err error) {
+	if !c.breakersEnabled() || errors.Is(err, context.Canceled) {
+		return
+	}
+	failed := err != nil || status >= 500
+	now := time.Now()
+	var change *stateChange
+	c.breakers.mu.Lock()
+	br := c.breakers.get(service, now)
+	switch br.status.State {
+	case BreakerClosed:
+		if now.Sub(br.windowStart) >= c.breakerWindow {
+			br.windowStart = now
+			br.status.Requests = 0
+			br.status.Failures = 0
+		}
+		br.status.Requests++
+		if failed {
+			br.status.Failures++
+		}
+		rate := float64(br.status.Failures) / float64(br.status.Requests)
+		if br.status.Requests >= c.breakerMinRequests && rate >= c.breakerFailureRate {
+			br.status.State = BreakerOpen
+			br.status.OpenedAt = now
+			change = &stateChange{service: service, from: BreakerClosed, to: BreakerOpen}
+		}
+	case BreakerHalfOpen:
+		br.trialAt = time.Time{}
+		if failed {
+			br.status.State = BreakerOpen
+			br.status.OpenedAt = now
+			change = &stateChange{service: service, from: BreakerHalfOpen, to: BreakerOpen}
+		} else {
+			br.status.State = BreakerClosed
+			br.status.Requests = 0
+			br.status.Failures = 0
+			br.windowStart = now
+			change = &stateChange{service: service, from: BreakerHalfOpen, to: BreakerClosed}
+		}
+	}
+	c.breakers.mu.Unlock()
+	c.fireBreakerChange(change)
+}
+
+func (c *Client) fireBreakerChange(change *stateChange) {
+	if change == nil {
+		return
+	}
+	c.logger.Printf("circuit breaker of %s-%d is %s", change.service.Name, change.service.ID, change.to)
+	c.instrumentation.BreakerStateChange(change.service, change.from, change.to)
+	if c.onBreakerStateChange != nil {
+		c.onBreakerStateChange(change.service, change.from, change.to)
+	}
+}
+
+// BreakerStatus returns the circuit breakers of every instance the client
+// has sent requests to, sorted by service name and ID. It is empty unless
+// BreakerFailureRate is set.
+func (c *Client) BreakerStatus() []BreakerStatus {
+	c.breakers.mu.Lock()
+	statuses := make([]BreakerStatus, 0, len(c.breakers.m))
+	for _, br := range c.breakers.m {
+		statuses = append(statuses, br.status)
+	}
+	c.breakers.mu.Unlock()
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Name != statuses[j].Name {
+			return statuses[i].Name < statuses[j].Name
+		}
+		return statuses[i].ID < statuses[j].ID
+	})
+	return statuses
+}
+
+// pickInstance picks one of the instances with the client's Balancer,
+// skipping instances ejected by the health prober and instances whose
+// circuit breaker does not allow a request. It returns ErrCircuitOpen if
+// the breakers of every instance are open.
+func (c *Client) pickInstance(instances []Service, key string) (*Service, error) {
+	candidates := c.healthyInstances(instances)
+	for len(candidates) > 0 {
+		service, count, err := c.balance(candidates, key)
+		if err != nil {
+			c.instrumentation.BalancerPick(candidates[0].Name, nil, err)
+			return nil, err
+		}
+		if c.allow(*service) {
+			count()
+			c.instrumentation.BalancerPick(service.Name, service, nil)
+			return service, nil
+		}
+		remaining := make([]Service, 0, len(candidates)-1)
+		for _, candidate := range candidates {
+			if candidate.ID != service.ID {
+				remaining = append(remaining, candidate)
+			}
+		}
+		candidates = remaining
+	}
+	if len(instances) == 0 {
+		return nil, ErrNoInstances
+	}
+	c.instrumentation.BalancerPick(instances[0].Name, nil, ErrCircuitOpen)
+	return nil, ErrCircuitOpen
+}
@@ -0,0 +1,119 @@
+package rincon
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	f := newFakeRincon(t)
+	var mu sync.Mutex
+	var changes []string
+	client := newTestClient(t, f, Config{
+		BreakerFailureRate: 0.5,
+		BreakerMinRequests: 4,
+		OnBreakerStateChange: func(service Service, from, to BreakerState) {
+			mu.Lock()
+			changes = append(changes, from.String()+"->"+to.String())
+			mu.Unlock()
+		},
+	})
+	client.breakerOpenDuration = 50 * time.Millisecond
+	service := Service{ID: 7, Name: "orders", Endpoint: "http://orders:8080"}
+	state := func() BreakerState {
+		return client.BreakerStatus()[0].State
+	}
+
+	// Below BreakerMinRequests the breaker stays closed.
+	client.recordResult(service, 500, nil)
+	client.recordResult(service, 0, errors.New("refused"))
+	client.recordResult(service, 200, nil)
+	if state() != BreakerClosed {
+		t.Fatalf("state = %s before BreakerMinRequests, want closed", state())
+	}
+	// A canceled request is not a failure.
+	client.recordResult(service, 0, context.Canceled)
+	if status := client.BreakerStatus()[0]; status.Requests != 3 {
+		t.Fatalf("Requests = %d, want the canceled request ignored", status.Requests)
+	}
+	client.recordResult(service, 503, nil)
+	if state() != BreakerOpen {
+		t.Fatalf("state = %s at a failure rate of 3/4, want open", state())
+	}
+	if client.allow(service) || client.available(service) {
+		t.Fatal("open breaker allowed a request")
+	}
+
+	// After the open duration a single trial is let through.
+	time.Sleep(60 * time.Millisecond)
+	if !client.available(service) || !client.allow(service) {
+		t.Fatal("breaker did not allow a trial after the open duration")
+	}
+	if state() != BreakerHalfOpen {
+		t.Fatalf("state = %s, want half-open", state())
+	}
+	if client.allow(service) {
+		t.Fatal("half-open breaker allowed a second trial")
+	}
+	client.recordResult(service, 500, nil)
+	if state() != BreakerOpen {
+		t.Fatalf("state = %s after a failed trial, want open", state())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	client.allow(service)
+	client.recordResult(service, 200, nil)
+	if state() != BreakerClosed {
+		t.Fatalf("state = %s after a successful trial, want closed", state())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("changes = %v, want %v", changes, want)
+		}
+	}
+}
+
+func TestPickInstanceSkipsOpenBreakers(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{BreakerFailureRate: 0.5, BreakerMinRequests: 1})
+	instances := []Service{
+		{ID: 7, Name: "orders", Version: "1.0.0", Endpoint: "http://orders-1:8080"},
+		{ID: 8, Name: "orders", Version: "1.0.0", Endpoint: "http://orders-2:8080"},
+	}
+	client.recordResult(instances[0], 500, nil)
+	for i := 0; i < 4; i++ {
+		service, err := client.pickInstance(instances, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if service.ID != 8 {
+			t.Fatalf("picked %d, want 8 while the breaker of 7 is open", service.ID)
+		}
+	}
+	client.recordResult(instances[1], 500, nil)
+	if _, err := client.pickInstance(instances, ""); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestBreakersDisabled(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	service := Service{ID: 7, Name: "orders"}
+	for i := 0; i < 20; i++ {
+		client.recordResult(service, 500, nil)
+	}
+	if !client.allow(service) || len(client.BreakerStatus()) != 0 {
+		t.Fatal("breakers used without a BreakerFailureRate")
+	}
+}
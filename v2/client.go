@@ -5,21 +5,100 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bk1031/rincon-go/v2/match"
 )
 
 // Client represents a client to the Rincon API.
 type Client struct {
+	// The configuration fields, including the balancer, and rincon are set
+	// by NewClient and never change, so they are read without a lock.
 	baseURL           *url.URL
 	heartbeatMode     HeartbeatMode
 	heartbeatInterval int
 	authUser          string
 	authPassword      string
-	userAgent         string
+	advertiseHost     string
+	advertiseScheme   string
+	conflictPolicy    ConflictPolicy
+	balancer          Balancer
+	identityPolicy    IdentityPolicy
+	stateFile         string
+	logger            *log.Logger
+	waitForHealthy    bool
 	httpClient        *http.Client
-	service           *Service
 	rincon            *Service
+
+	// serviceMu guards the registration and its routes, which the
+	// heartbeat, the watchdog and the caller may update at the same time.
+	serviceMu sync.RWMutex
+	service   *Service
+	routes    []Route
+	userAgent string
+
+	heartbeatCheck           func() error
+	heartbeatMissedThreshold int
+	onHeartbeatMissed        func(lastProbe time.Time, err error)
+	probeMu                  sync.Mutex
+	lastProbe                time.Time
+	watchdogStop             chan struct{}
+	heartbeatMu              sync.Mutex
+	heartbeatTicker          *time.Ticker
+	heartbeatStop            chan struct{}
+
+	snapshotPath     string
+	snapshotInterval int
+	snapshotMu       sync.RWMutex
+	snapshot         *Snapshot
+	routeTable       *match.Table
+	// fetchedTable holds the routes fetched by MatchRouteDetailed while no
+	// snapshot is loaded, and fetchedAt when they were fetched.
+	fetchedMu    sync.Mutex
+	fetchedTable *match.Table
+	fetchedAt    time.Time
+
+	// stop is closed by Close to stop the client's background loops.
+	stop      chan struct{}
+	closeOnce sync.Once
+
+	inflight inflight
+	draining atomic.Bool
+	// reconnected is set when the client is Connected again after being
+	// Disconnected, for the heartbeat or the watchdog to re-register.
+	reconnected atomic.Bool
+
+	healthProbeInterval int
+	healthyThreshold    int
+	unhealthyThreshold  int
+	healthProbeCooldown int
+	prober              healthProber
+
+	breakerFailureRate   float64
+	breakerMinRequests   int
+	breakerWindow        time.Duration
+	breakerOpenDuration  time.Duration
+	onBreakerStateChange func(service Service, from, to BreakerState)
+	breakers             breakers
+	callClient           *http.Client
+
+	requestPolicies *requestPolicies
+	retryBudget     float64
+	stats           serviceStats
+	limiters        map[string]*limiter
+	instrumentation Instrumentation
+	tracer          Tracer
+	debug           debugState
+	hooks           hooks
+
+	pingInterval        int
+	disconnectThreshold int
+	conn                connState
 }
 
 // Config represents the configuration for a Rincon Client.
@@ -30,33 +109,231 @@ type Client struct {
 // HeartbeatInterval is the interval of the heartbeat.
 // AuthUser is the username for authentication.
 // AuthPassword is the password for authentication.
+// AdvertiseHost overrides the host derived by RegisterListener.
+// AdvertiseScheme overrides the scheme used by RegisterListener, which
+// defaults to http.
+// ConflictPolicy decides whether Register checks its routes for conflicts
+// with routes of other services. It defaults to ConflictForce, which skips
+// the check.
+// Balancer picks the instance used by PickService and the Gateway.
+// It defaults to a NewestVersionBalancer.
+// IdentityPolicy decides whether the first registration reuses or replaces
+// an instance left over from a previous run. It defaults to IdentityNew.
+// StateFile is the file the registered service ID is persisted to, so that
+// the IdentityPolicy can find the previous instance after a restart even
+// if its endpoint changed.
+// Logger receives the client's log output. It defaults to the standard
+// logger of the log package.
+// WaitForHealthy makes WaitForServices and WaitForRoute also wait for a
+// dependency's HealthCheck to respond with a 2xx status.
+// HeartbeatCheck is called before each heartbeat in ClientHeartbeat mode.
+// If it returns an error, the heartbeat is skipped.
+// HeartbeatMissedThreshold is the number of heartbeat intervals without a
+// Rincon health probe before the client considers itself dropped when in
+// ServerHeartbeat mode. It defaults to 3.
+// OnHeartbeatMissed is called after the client attempts to re-register
+// because no probe arrived within the threshold.
+// SnapshotPath is the file a Snapshot of the registry is persisted to and
+// loaded from on startup. When a snapshot is loaded, the client can be
+// created and serve lookups while Rincon is unreachable.
+// SnapshotInterval is the interval in seconds at which the snapshot, and
+// the route table used by MatchRouteLocal, is refreshed. If it is zero,
+// the snapshot is only taken on startup when SnapshotPath is set.
+// HealthProbeInterval is the interval in seconds at which the HealthCheck
+// of every instance returned by a lookup is probed. Instances that fail
+// UnhealthyThreshold probes in a row, through a connection error or a 5xx
+// status, are skipped by PickService and the Gateway. If it is zero, no
+// probing is done.
+// HealthyThreshold is the number of probes in a row an ejected instance
+// must pass to be selected again. It defaults to 2.
+// UnhealthyThreshold is the number of probes in a row an instance must
+// fail to be ejected. It defaults to 3.
+// HealthProbeCooldown is the time in seconds an ejected instance is left
+// alone before it is probed again. It defaults to 30.
+// BreakerFailureRate is the share of failed requests, between 0 and 1, at
+// which the circuit breaker of an instance opens. Requests sent through a
+// Transport, Call and the Gateway are counted, and connection errors and
+// 5xx responses are failures. If it is zero, no breakers are used.
+// BreakerMinRequests is the number of requests in a window before the
+// breaker may open. It defaults to 10.
+// BreakerWindow is the time in seconds over which requests are counted.
+// It defaults to 10.
+// BreakerOpenDuration is the time in seconds an open breaker rejects
+// requests before letting a trial request through. It defaults to 30.
+// OnBreakerStateChange is called when the breaker of an instance changes
+// state.
+// RequestPolicies opt routes of other services into hedging and retries
+// when they are called through a Transport, Call or the Gateway.
+// RetryBudget is the number of hedges and retries that each request with a
+// policy earns for its service, on top of a burst of 10. If it is nil, it
+// defaults to 0.1, which caps the extra load at about 10%. A budget of 0
+// disables the budget, so that hedges and retries are only limited by
+// their RequestPolicy.
+// ServiceLimits caps the rate and concurrency of the requests sent to each
+// named service through a Transport or Call.
+// Instrumentation receives events about Rincon requests, heartbeats,
+// lookups, balancer picks and circuit breakers. Use a Metrics to export
+// them to Prometheus.
+// Tracer receives a span for every request to Rincon and to service
+// instances. Use a TraceRecorder to inspect them in tests.
+// PingInterval is the interval in seconds at which Rincon is pinged to
+// keep the client's State up to date when no other request was made. It
+// defaults to 10.
+// DisconnectThreshold is the number of requests to Rincon in a row that
+// must fail to connect before the client is Disconnected. It defaults to 3.
 type Config struct {
-	BaseURL           string
-	HeartbeatMode     HeartbeatMode
-	HeartbeatInterval int
-	AuthUser          string
-	AuthPassword      string
+	BaseURL                  string
+	HeartbeatMode            HeartbeatMode
+	HeartbeatInterval        int
+	AuthUser                 string
+	AuthPassword             string
+	AdvertiseHost            string
+	AdvertiseScheme          string
+	ConflictPolicy           ConflictPolicy
+	Balancer                 Balancer
+	IdentityPolicy           IdentityPolicy
+	StateFile                string
+	Logger                   *log.Logger
+	WaitForHealthy           bool
+	HeartbeatCheck           func() error
+	HeartbeatMissedThreshold int
+	OnHeartbeatMissed        func(lastProbe time.Time, err error)
+	SnapshotPath             string
+	SnapshotInterval         int
+	HealthProbeInterval      int
+	HealthyThreshold         int
+	UnhealthyThreshold       int
+	HealthProbeCooldown      int
+	BreakerFailureRate       float64
+	BreakerMinRequests       int
+	BreakerWindow            int
+	BreakerOpenDuration      int
+	OnBreakerStateChange     func(service Service, from, to BreakerState)
+	RequestPolicies          []RequestPolicy
+	RetryBudget              *float64
+	ServiceLimits            map[string]ServiceLimit
+	Instrumentation          Instrumentation
+	Tracer                   Tracer
+	PingInterval             int
+	DisconnectThreshold      int
 }
 
 // NewClient creates a new Rincon Client with the given Config.
-// It returns an error if the BaseURL is invalid or the
+// It returns an error if the Config is invalid or the
 // client cannot connect to the Rincon server.
 func NewClient(config Config) (*Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 	baseURL, err := url.Parse(config.BaseURL)
 	if err != nil {
 		return nil, err
 	}
+	if config.HeartbeatMissedThreshold <= 0 {
+		config.HeartbeatMissedThreshold = 3
+	}
+	if config.HealthyThreshold <= 0 {
+		config.HealthyThreshold = 2
+	}
+	if config.UnhealthyThreshold <= 0 {
+		config.UnhealthyThreshold = 3
+	}
+	if config.HealthProbeCooldown <= 0 {
+		config.HealthProbeCooldown = 30
+	}
+	if config.BreakerMinRequests <= 0 {
+		config.BreakerMinRequests = 10
+	}
+	if config.BreakerWindow <= 0 {
+		config.BreakerWindow = 10
+	}
+	if config.BreakerOpenDuration <= 0 {
+		config.BreakerOpenDuration = 30
+	}
+	retryBudget := 0.1
+	if config.RetryBudget != nil {
+		retryBudget = *config.RetryBudget
+	}
+	if config.PingInterval <= 0 {
+		config.PingInterval = 10
+	}
+	if config.DisconnectThreshold <= 0 {
+		config.DisconnectThreshold = 3
+	}
+	if config.Instrumentation == nil {
+		config.Instrumentation = nopInstrumentation{}
+	}
+	if config.Tracer == nil {
+		config.Tracer = nopTracer{}
+	}
+	if config.Logger == nil {
+		config.Logger = log.Default()
+	}
+	if config.Balancer == nil {
+		config.Balancer = &NewestVersionBalancer{}
+	}
 	client := &Client{
-		baseURL:           baseURL,
-		heartbeatMode:     config.HeartbeatMode,
-		heartbeatInterval: config.HeartbeatInterval,
-		authUser:          config.AuthUser,
-		authPassword:      config.AuthPassword,
-		userAgent:         "rincon-go",
-		httpClient:        &http.Client{},
+		baseURL:                  baseURL,
+		heartbeatMode:            config.HeartbeatMode,
+		heartbeatInterval:        config.HeartbeatInterval,
+		authUser:                 config.AuthUser,
+		authPassword:             config.AuthPassword,
+		advertiseHost:            config.AdvertiseHost,
+		advertiseScheme:          config.AdvertiseScheme,
+		conflictPolicy:           config.ConflictPolicy,
+		balancer:                 config.Balancer,
+		identityPolicy:           config.IdentityPolicy,
+		stateFile:                config.StateFile,
+		logger:                   config.Logger,
+		waitForHealthy:           config.WaitForHealthy,
+		userAgent:                "rincon-go",
+		stop:                     make(chan struct{}),
+		httpClient:               &http.Client{},
+		heartbeatCheck:           config.HeartbeatCheck,
+		heartbeatMissedThreshold: config.HeartbeatMissedThreshold,
+		onHeartbeatMissed:        config.OnHeartbeatMissed,
+		snapshotPath:             config.SnapshotPath,
+		snapshotInterval:         config.SnapshotInterval,
+		routeTable:               match.NewTable(nil),
+		healthProbeInterval:      config.HealthProbeInterval,
+		healthyThreshold:         config.HealthyThreshold,
+		unhealthyThreshold:       config.UnhealthyThreshold,
+		healthProbeCooldown:      config.HealthProbeCooldown,
+		breakerFailureRate:       config.BreakerFailureRate,
+		breakerMinRequests:       config.BreakerMinRequests,
+		breakerWindow:            time.Duration(config.BreakerWindow) * time.Second,
+		breakerOpenDuration:      time.Duration(config.BreakerOpenDuration) * time.Second,
+		onBreakerStateChange:     config.OnBreakerStateChange,
+		retryBudget:              retryBudget,
+		instrumentation:          config.Instrumentation,
+		tracer:                   config.Tracer,
+		pingInterval:             config.PingInterval,
+		disconnectThreshold:      config.DisconnectThreshold,
+	}
+	if len(config.RequestPolicies) > 0 {
+		if client.requestPolicies, err = compileRequestPolicies(config.RequestPolicies); err != nil {
+			return nil, err
+		}
+	}
+	client.limiters = make(map[string]*limiter, len(config.ServiceLimits))
+	for name, limit := range config.ServiceLimits {
+		client.limiters[name] = newLimiter(limit)
+	}
+	client.callClient = &http.Client{Transport: NewTransport(client)}
+	if client.snapshotPath != "" {
+		if err = client.loadSnapshotFile(); err != nil {
+			client.logger.Printf("failed to load snapshot: %s", err)
+		}
 	}
 	if _, err = client.Ping(); err != nil {
-		return nil, err
+		if !isUnreachable(err) || client.currentSnapshot() == nil {
+			return nil, err
+		}
+		client.logger.Printf("rincon is unreachable, using snapshot: %s", err)
+	} else if client.snapshotPath != "" || client.snapshotInterval > 0 {
+		if _, err = client.Snapshot(); err != nil {
+			client.logger.Printf("failed to take snapshot: %s", err)
+		}
 	}
 	services, err := client.GetServicesByName("rincon")
 	if err != nil {
@@ -67,9 +344,28 @@ func NewClient(config Config) (*Client, error) {
 	} else {
 		client.rincon = &services[0]
 	}
+	if client.snapshotInterval > 0 {
+		go client.refreshSnapshots()
+	}
+	if client.healthProbeInterval > 0 {
+		go client.runHealthProber()
+	}
+	go client.runPings()
 	return client, nil
 }
 
+// Close stops the client's background loops: the heartbeat, the watchdog,
+// the pings, the refreshing of snapshots and the health prober. It does
+// not deregister the service, so call Deregister or Drain first to remove
+// it from Rincon.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+	})
+	c.stopWatchdog()
+	c.stopClientHeartbeat()
+}
+
 func (c *Client) newRequest(method, path string, body interface{}, params map[string]string) (*http.Request, error) {
 	rel := &url.URL{Path: path}
 	u := c.baseURL.ResolveReference(rel)
@@ -99,14 +395,27 @@ func (c *Client) newRequest(method, path string, body interface{}, params map[st
 		req.Header.Set("Content-Type", "application/json")
 	}
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("User-Agent", c.currentUserAgent())
 	req.SetBasicAuth(c.authUser, c.authPassword)
 	return req, nil
 }
 
 func (c *Client) do(req *http.Request, v interface{}) (*http.Response, *ErrorResponse, error) {
+	endpoint := endpointLabel(req.URL.Path)
+	span, req := c.startSpan(req, req.Method+" "+endpoint, nil)
+	start := time.Now()
 	resp, err := c.httpClient.Do(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	c.endSpan(span, status, err)
+	c.instrumentation.RinconRequest(endpoint, req.Method, status, time.Since(start))
+	if req.Context().Err() == nil {
+		c.recordOutcome(status, err)
+	}
 	if err != nil {
+		c.recordError("%s %s: %s", req.Method, req.URL.Path, err)
 		return nil, nil, err
 	}
 	defer resp.Body.Close()
@@ -119,6 +428,7 @@ func (c *Client) do(req *http.Request, v interface{}) (*http.Response, *ErrorRes
 		respError := new(ErrorResponse)
 		err = json.Unmarshal(body, respError)
 		respError.StatusCode = resp.StatusCode
+		c.recordError("%s %s: [%d] %s", req.Method, req.URL.Path, respError.StatusCode, respError.Message)
 		return resp, respError, err
 	}
 	return resp, nil, err
@@ -0,0 +1,209 @@
+// Command rincon-sidecar registers a service with Rincon on behalf of an
+// application that cannot use the client library.
+//
+// Usage:
+//
+//	rincon-sidecar -f service.json [flags]
+//
+// The definition file is read with rincon.LoadConfig and describes the
+// client configuration, the service and its routes. The sidecar waits for
+// the application's port to answer, registers the service and runs the
+// client heartbeat. If -health-url is set, each heartbeat is only sent
+// while the application's health endpoint responds with a 2xx status.
+// The service is deregistered when the application's port stops answering
+// or the sidecar receives SIGINT or SIGTERM, waiting at most
+// -shutdown-timeout for Rincon to confirm.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bk1031/rincon-go/v2"
+)
+
+type options struct {
+	file            string
+	appAddr         string
+	healthURL       string
+	checkInterval   time.Duration
+	failures        int
+	startupTimeout  time.Duration
+	shutdownTimeout time.Duration
+}
+
+func main() {
+	opts := options{}
+	flag.StringVar(&opts.file, "f", os.Getenv("RINCON_SIDECAR_CONFIG"), "service definition file")
+	flag.StringVar(&opts.appAddr, "app-addr", "", "address of the application, defaults to the port of the service endpoint on localhost")
+	flag.StringVar(&opts.healthURL, "health-url", "", "health endpoint of the application to probe before each heartbeat")
+	flag.DurationVar(&opts.checkInterval, "check-interval", 5*time.Second, "interval between checks of the application port")
+	flag.IntVar(&opts.failures, "failures", 3, "consecutive failed port checks before deregistering")
+	flag.DurationVar(&opts.startupTimeout, "startup-timeout", time.Minute, "time to wait for the application port before giving up")
+	flag.DurationVar(&opts.shutdownTimeout, "shutdown-timeout", 10*time.Second, "time to wait for Rincon to deregister the service on shutdown")
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		log.Fatalf("rincon-sidecar: %s", err)
+	}
+}
+
+func run(opts options) error {
+	if opts.file == "" {
+		return fmt.Errorf("a service definition file is required, use -f")
+	}
+	file, err := rincon.LoadConfig(opts.file)
+	if err != nil {
+		return err
+	}
+	config, err := clientConfig(file, opts.healthURL)
+	if err != nil {
+		return err
+	}
+	if opts.appAddr == "" {
+		opts.appAddr, err = localAddr(file.Service.Endpoint)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("waiting for %s", opts.appAddr)
+	if err = waitForPort(ctx, opts.appAddr, opts.checkInterval, opts.startupTimeout); err != nil {
+		return err
+	}
+
+	client, err := rincon.NewClient(config)
+	if err != nil {
+		return err
+	}
+	id, err := client.Register(file.Service, file.Routes)
+	if err != nil {
+		return err
+	}
+	log.Printf("registered %s with id %d", file.Service.Name, id)
+
+	err = watchPort(ctx, opts.appAddr, opts.checkInterval, opts.failures)
+	client.StopHeartbeat()
+	id = client.Service().ID
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), opts.shutdownTimeout)
+	defer cancel()
+	if deregisterErr := client.DeregisterContext(shutdownCtx); deregisterErr != nil {
+		return fmt.Errorf("failed to deregister: %w", deregisterErr)
+	}
+	log.Printf("deregistered %s with id %d", file.Service.Name, id)
+	return err
+}
+
+// clientConfig returns the client configuration of the definition file,
+// switched to client heartbeats, which the sidecar always sends. It is
+// checked here so that a missing interval is reported by its JSON key.
+func clientConfig(file *rincon.ConfigFile, healthURL string) (rincon.Config, error) {
+	config := file.Config
+	config.HeartbeatMode = rincon.ClientHeartbeat
+	if config.HeartbeatInterval == 0 {
+		return config, &rincon.ConfigError{Field: "heartbeat_interval", Err: errors.New("must be set, since the sidecar sends client heartbeats")}
+	}
+	if healthURL != "" {
+		config.HeartbeatCheck = healthCheck(healthURL)
+	}
+	return config, nil
+}
+
+// localAddr returns the address of the port of the given endpoint on
+// the loopback interface.
+func localAddr(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("cannot derive application address from endpoint %q, use -app-addr", endpoint)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort("127.0.0.1", port), nil
+}
+
+// waitForPort blocks until the given address accepts connections, the
+// timeout expires or the context is done.
+func waitForPort(ctx context.Context, addr string, interval, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !portOpen(addr, interval) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not answer within %s", addr, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+	return nil
+}
+
+// watchPort blocks until the given address fails the given number of
+// consecutive checks, in which case it returns an error, or the context
+// is done, in which case it returns nil.
+func watchPort(ctx context.Context, addr string, interval time.Duration, failures int) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failed := 0
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("received shutdown signal")
+			return nil
+		case <-ticker.C:
+			if portOpen(addr, interval) {
+				failed = 0
+				continue
+			}
+			failed++
+			log.Printf("%s is not answering (%d/%d)", addr, failed, failures)
+			if failed >= failures {
+				return fmt.Errorf("%s stopped answering", addr)
+			}
+		}
+	}
+}
+
+func portOpen(addr string, timeout time.Duration) bool {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// healthCheck returns a heartbeat check that requires the given URL to
+// respond with a 2xx status.
+func healthCheck(healthURL string) func() error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	return func() error {
+		resp, err := client.Get(healthURL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("health check returned %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bk1031/rincon-go/v2"
+)
+
+func TestLocalAddr(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+		ok       bool
+	}{
+		{"http://orders:8080", "127.0.0.1:8080", true},
+		{"http://orders", "127.0.0.1:80", true},
+		{"https://orders", "127.0.0.1:443", true},
+		{"orders:8080", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, err := localAddr(tt.endpoint)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("localAddr(%q) = %q, %v; want %q, ok %v", tt.endpoint, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	file := &rincon.ConfigFile{Config: rincon.Config{BaseURL: "http://localhost:10311"}}
+	_, err := clientConfig(file, "")
+	var configErr *rincon.ConfigError
+	if !errors.As(err, &configErr) || configErr.Field != "heartbeat_interval" {
+		t.Fatalf("missing interval: err = %v, want a ConfigError for heartbeat_interval", err)
+	}
+
+	file.Config.HeartbeatInterval = 10
+	config, err := clientConfig(file, "http://localhost:8080/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.HeartbeatMode != rincon.ClientHeartbeat || config.HeartbeatCheck == nil {
+		t.Fatalf("HeartbeatMode = %s, HeartbeatCheck set = %v", config.HeartbeatMode, config.HeartbeatCheck != nil)
+	}
+}
+
+func TestWaitForPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	if err := waitForPort(context.Background(), addr, 10*time.Millisecond, time.Second); err != nil {
+		t.Fatalf("open port: %s", err)
+	}
+	listener.Close()
+	if err := waitForPort(context.Background(), addr, 10*time.Millisecond, 50*time.Millisecond); err == nil {
+		t.Fatal("closed port: expected a timeout")
+	}
+}
+
+func TestWatchPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := watchPort(ctx, addr, 10*time.Millisecond, 2); err != nil {
+		t.Fatalf("open port until shutdown: %s", err)
+	}
+
+	listener.Close()
+	if err := watchPort(context.Background(), addr, 10*time.Millisecond, 2); err == nil {
+		t.Fatal("closed port: expected an error")
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	check := healthCheck(server.URL)
+	if err := check(); err != nil {
+		t.Fatalf("healthy: %s", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := check(); err == nil {
+		t.Fatal("unhealthy: expected an error")
+	}
+}
@@ -0,0 +1,369 @@
+// Command rincon inspects and operates a Rincon registry.
+//
+// Usage:
+//
+//	rincon <command> [flags] [args]
+//
+// The commands are:
+//
+//	ping                    check that the registry is reachable
+//	services [name]         list all services, or the instances of one
+//	routes [service]        list all routes, or the routes of one service
+//	match <route>           show the service that handles a route
+//	check-match             compare local route matching with the server
+//	register -f file        register a service from a definition file
+//	deregister <id>         remove a service instance
+//	heartbeat -f file       register a service and heartbeat until interrupted
+//
+// Every command accepts -url, -user, -password, -interval and -o flags.
+// They default to the configuration read by rincon.ConfigFromEnvDefaults
+// and the RINCON_OUTPUT environment variable. The credentials have no
+// default and must be set with RINCON_USER and RINCON_PASSWORD or the
+// -user and -password flags.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/bk1031/rincon-go/v2"
+	"github.com/bk1031/rincon-go/v2/match"
+)
+
+const usage = `usage: rincon <command> [flags] [args]
+
+commands:
+  ping                    check that the registry is reachable
+  services [name]         list all services, or the instances of one
+  routes [service]        list all routes, or the routes of one service
+  match <route>           show the service that handles a route
+  check-match             compare local route matching with the server
+  register -f file        register a service from a definition file
+  deregister <id>         remove a service instance
+  heartbeat -f file       register a service and heartbeat until interrupted
+
+run "rincon <command> -h" for the flags of a command
+`
+
+// definition is the format of the file passed to register and heartbeat.
+type definition struct {
+	Service rincon.Service `json:"service"`
+	Routes  []rincon.Route `json:"routes"`
+}
+
+// options holds the flags shared by every command.
+type options struct {
+	config rincon.Config
+	output string
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	commands := map[string]func(*options, []string) error{
+		"ping":        ping,
+		"services":    services,
+		"routes":      routes,
+		"match":       matchRoute,
+		"check-match": checkMatch,
+		"register":    register,
+		"deregister":  deregister,
+		"heartbeat":   heartbeat,
+	}
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		fmt.Fprint(os.Stdout, usage)
+		return
+	}
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "rincon: unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+	config, err := envConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rincon: %s\n", err)
+		os.Exit(2)
+	}
+	if err = command(&options{config: config}, os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "rincon %s: %s\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet returns a flag set for the named command with the shared
+// flags already defined on it.
+func newFlagSet(name string, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet("rincon "+name, flag.ExitOnError)
+	fs.StringVar(&opts.config.BaseURL, "url", opts.config.BaseURL, "Rincon server URL")
+	fs.StringVar(&opts.config.AuthUser, "user", opts.config.AuthUser, "Rincon username")
+	fs.StringVar(&opts.config.AuthPassword, "password", opts.config.AuthPassword, "Rincon password")
+	fs.IntVar(&opts.config.HeartbeatInterval, "interval", opts.config.HeartbeatInterval, "heartbeat interval in seconds")
+	fs.StringVar(&opts.output, "o", envOr("RINCON_OUTPUT", "table"), "output format, table, json or yaml")
+	return fs
+}
+
+// parse parses args with the given flag set, allowing flags to appear after
+// positional arguments, and returns the positional arguments.
+func parse(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func (opts *options) client() (*rincon.Client, error) {
+	if opts.config.AuthUser == "" || opts.config.AuthPassword == "" {
+		return nil, fmt.Errorf("set RINCON_USER/RINCON_PASSWORD or -user/-password")
+	}
+	return rincon.NewClient(opts.config)
+}
+
+func envOr(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// envConfig returns the Config described by the RINCON_* environment
+// variables. Unset variables default to a local Rincon server and a ten
+// second heartbeat. The credentials have no default.
+func envConfig() (rincon.Config, error) {
+	defaults := rincon.Config{
+		BaseURL:           "http://localhost:10311",
+		HeartbeatInterval: 10,
+	}
+	return rincon.ConfigFromEnvDefaults(defaults)
+}
+
+func ping(opts *options, args []string) error {
+	fs := newFlagSet("ping", opts)
+	parse(fs, args)
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+	p, err := client.Ping()
+	if err != nil {
+		return err
+	}
+	return write(os.Stdout, opts.output, p)
+}
+
+func services(opts *options, args []string) error {
+	fs := newFlagSet("services", opts)
+	version := fs.String("version", "", "only list instances matching a version constraint, such as \">=2.3 <3\"")
+	args = parse(fs, args)
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+	var result []rincon.Service
+	if len(args) > 0 && *version != "" {
+		result, err = client.GetServicesByName(args[0], *version)
+	} else if len(args) > 0 {
+		result, err = client.GetServicesByName(args[0])
+	} else {
+		result, err = client.ListServices()
+	}
+	if err != nil {
+		return err
+	}
+	return write(os.Stdout, opts.output, result)
+}
+
+func routes(opts *options, args []string) error {
+	fs := newFlagSet("routes", opts)
+	args = parse(fs, args)
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+	var result []rincon.Route
+	if len(args) > 0 {
+		result, err = client.RoutesForService(args[0])
+	} else {
+		result, err = client.ListRoutes()
+	}
+	if err != nil {
+		return err
+	}
+	return write(os.Stdout, opts.output, result)
+}
+
+func matchRoute(opts *options, args []string) error {
+	fs := newFlagSet("match", opts)
+	method := fs.String("method", "GET", "HTTP method of the request")
+	local := fs.Bool("local", false, "match against the route table locally instead of on the server")
+	explain := fs.Bool("explain", false, "show the matched pattern, its parameters and the other candidates")
+	args = parse(fs, args)
+	if len(args) != 1 {
+		return fmt.Errorf("expected exactly one route")
+	}
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+	if *explain {
+		result, err := client.MatchRouteDetailed(args[0], *method)
+		if err != nil {
+			return err
+		}
+		return write(os.Stdout, opts.output, result)
+	}
+	var service *rincon.Service
+	if *local {
+		if _, err = client.Snapshot(); err != nil {
+			return err
+		}
+		service, err = client.MatchRouteLocal(args[0], *method)
+	} else {
+		service, err = client.LookupRoute(context.Background(), args[0], *method)
+	}
+	if err != nil {
+		return err
+	}
+	return write(os.Stdout, opts.output, service)
+}
+
+// mismatch is a probe for which local matching and the server disagree.
+type mismatch struct {
+	Path   string `json:"path"`
+	Method string `json:"method"`
+	Server string `json:"server"`
+	Local  string `json:"local"`
+}
+
+// checkMatch probes every registered route and compares the service chosen
+// by the server's /rincon/match endpoint with the local route table.
+func checkMatch(opts *options, args []string) error {
+	fs := newFlagSet("check-match", opts)
+	parse(fs, args)
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+	snapshot, err := client.Snapshot()
+	if err != nil {
+		return err
+	}
+	routes := make([]match.Route, len(snapshot.Routes))
+	for i, route := range snapshot.Routes {
+		routes[i] = match.Route{Route: route.Route, Method: route.Method, Service: route.ServiceName}
+	}
+	table := match.NewTable(routes)
+	mismatches := make([]mismatch, 0)
+	probes := match.Probes(routes)
+	for _, probe := range probes {
+		server := "-"
+		if service, err := client.LookupRoute(context.Background(), probe.Path, probe.Method); err == nil {
+			server = service.Name
+		}
+		local := "-"
+		if route, ok := table.Match(probe.Path, probe.Method); ok {
+			local = route.Service
+		}
+		if server != local {
+			mismatches = append(mismatches, mismatch{Path: probe.Path, Method: probe.Method, Server: server, Local: local})
+		}
+	}
+	if err = write(os.Stdout, opts.output, mismatches); err != nil {
+		return err
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%d of %d probes disagree", len(mismatches), len(probes))
+	}
+	return nil
+}
+
+func register(opts *options, args []string) error {
+	fs := newFlagSet("register", opts)
+	file := fs.String("f", "", "service definition file")
+	parse(fs, args)
+	def, err := readDefinition(*file)
+	if err != nil {
+		return err
+	}
+	opts.config.HeartbeatMode = rincon.ServerHeartbeat
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+	if _, err = client.Register(def.Service, def.Routes); err != nil {
+		return err
+	}
+	return write(os.Stdout, opts.output, client.Service())
+}
+
+func deregister(opts *options, args []string) error {
+	fs := newFlagSet("deregister", opts)
+	args = parse(fs, args)
+	if len(args) != 1 {
+		return fmt.Errorf("expected exactly one service id")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid service id %q", args[0])
+	}
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+	return client.DeregisterByID(id)
+}
+
+func heartbeat(opts *options, args []string) error {
+	fs := newFlagSet("heartbeat", opts)
+	file := fs.String("f", "", "service definition file")
+	parse(fs, args)
+	def, err := readDefinition(*file)
+	if err != nil {
+		return err
+	}
+	opts.config.HeartbeatMode = rincon.ClientHeartbeat
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+	if _, err = client.Register(def.Service, def.Routes); err != nil {
+		return err
+	}
+	if err = write(os.Stdout, opts.output, client.Service()); err != nil {
+		return err
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	client.StopHeartbeat()
+	return client.Deregister()
+}
+
+func readDefinition(path string) (*definition, error) {
+	if path == "" {
+		return nil, fmt.Errorf("a service definition file is required, use -f")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	def := new(definition)
+	if err = json.Unmarshal(data, def); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return def, nil
+}
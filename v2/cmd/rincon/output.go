@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bk1031/rincon-go/v2"
+)
+
+// write writes v to w in the given output format.
+func write(w io.Writer, format string, v interface{}) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case "yaml":
+		return writeYAML(w, v)
+	case "table", "":
+		return writeTable(w, v)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// writeTable writes the known result types as aligned columns.
+func writeTable(w io.Writer, v interface{}) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	switch v := v.(type) {
+	case *rincon.Ping:
+		fmt.Fprintln(tw, "MESSAGE\tSERVICES\tROUTES")
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", v.Message, v.Services, v.Routes)
+	case *rincon.Service:
+		return writeTable(w, []rincon.Service{*v})
+	case []rincon.Service:
+		fmt.Fprintln(tw, "ID\tNAME\tVERSION\tENDPOINT\tHEALTH CHECK\tUPDATED")
+		for _, s := range v {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", s.ID, s.Name, s.Version, s.Endpoint, s.HealthCheck, s.UpdatedAt.Format(time.RFC3339))
+		}
+	case []rincon.Route:
+		fmt.Fprintln(tw, "ROUTE\tMETHOD\tSERVICE")
+		for _, r := range v {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Route, r.Method, r.ServiceName)
+		}
+	case *rincon.MatchResult:
+		if err := writeTable(w, v.Service); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(tw, "\tMETHOD\tROUTE\tSERVICE\tPARAMS")
+		fmt.Fprintf(tw, "matched\t%s\t%s\t%s\t%s\n", v.Route.Method, v.Route.Route, v.Route.ServiceName, strings.Join(v.Params, ","))
+		for _, r := range v.Candidates {
+			fmt.Fprintf(tw, "candidate\t%s\t%s\t%s\t\n", r.Method, r.Route, r.ServiceName)
+		}
+	case []mismatch:
+		fmt.Fprintln(tw, "PATH\tMETHOD\tSERVER\tLOCAL")
+		for _, m := range v {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", m.Path, m.Method, m.Server, m.Local)
+		}
+	default:
+		return writeYAML(w, v)
+	}
+	return tw.Flush()
+}
+
+// writeYAML writes v as a minimal YAML document. Values are converted
+// through their JSON encoding, so field names match the json tags.
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var generic interface{}
+	if err = json.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	var sb strings.Builder
+	yamlValue(&sb, generic, 0)
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+func yamlValue(sb *strings.Builder, v interface{}, indent int) {
+	prefix := strings.Repeat("  ", indent)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sb.WriteString(prefix + key + ":")
+			yamlChild(sb, v[key], indent)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			sb.WriteString(prefix + "[]\n")
+		}
+		for _, item := range v {
+			sb.WriteString(prefix + "-")
+			yamlChild(sb, item, indent)
+		}
+	default:
+		sb.WriteString(prefix + yamlScalar(v) + "\n")
+	}
+}
+
+// yamlChild writes a nested value after a key or list marker.
+func yamlChild(sb *strings.Builder, v interface{}, indent int) {
+	switch child := v.(type) {
+	case map[string]interface{}:
+		if len(child) == 0 {
+			sb.WriteString(" {}\n")
+			return
+		}
+		sb.WriteString("\n")
+		yamlValue(sb, child, indent+1)
+	case []interface{}:
+		if len(child) == 0 {
+			sb.WriteString(" []\n")
+			return
+		}
+		sb.WriteString("\n")
+		yamlValue(sb, child, indent+1)
+	default:
+		sb.WriteString(" " + yamlScalar(child) + "\n")
+	}
+}
+
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		if v == "" || yamlAmbiguous(v) || strings.ContainsAny(v, ":#{}[],&*?|<>=!%@`'\"\\\n\t") || strings.TrimSpace(v) != v || strings.HasPrefix(v, "-") {
+			return quoteJSON(v)
+		}
+		return v
+	default:
+		return quoteJSON(v)
+	}
+}
+
+// yamlAmbiguous reports whether a plain YAML scalar s would be read as
+// something other than a string, such as a boolean, null or a number.
+func yamlAmbiguous(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "y", "n", "on", "off", "null", "~",
+		".inf", "-.inf", "+.inf", ".nan":
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	_, err := strconv.ParseInt(s, 0, 64)
+	return err == nil
+}
+
+// quoteJSON encodes v as JSON, which is also valid YAML, without escaping
+// HTML characters such as "<" and ">".
+func quoteJSON(v interface{}) string {
+	var sb strings.Builder
+	encoder := json.NewEncoder(&sb)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(v)
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bk1031/rincon-go/v2"
+)
+
+var testServices = []rincon.Service{{
+	ID:          3,
+	Name:        "orders",
+	Version:     "1.2.0",
+	Endpoint:    "http://orders:8080",
+	HealthCheck: "http://orders:8080/health",
+	UpdatedAt:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+}}
+
+func TestWriteFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		v      interface{}
+		want   []string
+	}{
+		{"table", testServices, []string{
+			"ID  NAME    VERSION  ENDPOINT            HEALTH CHECK               UPDATED",
+			"3   orders  1.2.0    http://orders:8080  http://orders:8080/health  2024-05-01T12:00:00Z",
+		}},
+		{"table", []rincon.Route{{Route: "/orders/**", Method: "GET,POST", ServiceName: "orders"}}, []string{
+			"ROUTE       METHOD    SERVICE",
+			"/orders/**  GET,POST  orders",
+		}},
+		{"json", &rincon.Ping{Message: "ok", Services: 2, Routes: 5}, []string{
+			`  "message": "ok",`,
+			`  "routes": 5,`,
+			`  "services": 2`,
+		}},
+		{"yaml", testServices, []string{
+			"-\n",
+			"  endpoint: \"http://orders:8080\"",
+			"  id: 3",
+			"  name: orders",
+		}},
+	}
+	for _, tt := range tests {
+		var sb strings.Builder
+		if err := write(&sb, tt.format, tt.v); err != nil {
+			t.Fatalf("%s: %s", tt.format, err)
+		}
+		for _, line := range tt.want {
+			if !strings.Contains(sb.String(), line) {
+				t.Errorf("%s output is missing %q:\n%s", tt.format, line, sb.String())
+			}
+		}
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	var sb strings.Builder
+	if err := write(&sb, "xml", testServices); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
+
+func TestYAMLScalarQuoting(t *testing.T) {
+	tests := map[string]string{
+		"orders":        "orders",
+		"":              `""`,
+		"a: b":          `"a: b"`,
+		" padded":       `" padded"`,
+		">=2.3 <3":      `">=2.3 <3"`,
+		"/orders/**":    `"/orders/**"`,
+		"plain-value_1": "plain-value_1",
+		"1.10":          `"1.10"`,
+		"42":            `"42"`,
+		"0x1F":          `"0x1F"`,
+		"true":          `"true"`,
+		"No":            `"No"`,
+		"null":          `"null"`,
+		"~":             `"~"`,
+		"- item":        `"- item"`,
+		"v1.10":         "v1.10",
+	}
+	for in, want := range tests {
+		if got := yamlScalar(in); got != want {
+			t.Errorf("yamlScalar(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestParseAllowsFlagsAfterArguments(t *testing.T) {
+	opts := &options{}
+	fs := newFlagSet("services", opts)
+	version := fs.String("version", "", "")
+	args := parse(fs, []string{"orders", "-o", "json", "-version", ">=2"})
+	if !reflect.DeepEqual(args, []string{"orders"}) {
+		t.Fatalf("positional = %q, want [orders]", args)
+	}
+	if opts.output != "json" || *version != ">=2" {
+		t.Fatalf("output = %q, version = %q", opts.output, *version)
+	}
+}
+
+func TestEnvConfigDefaults(t *testing.T) {
+	for _, key := range []string{"RINCON_URL", "RINCON_USER", "RINCON_PASSWORD", "RINCON_HEARTBEAT_INTERVAL"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	config, err := envConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.BaseURL != "http://localhost:10311" || config.HeartbeatInterval != 10 {
+		t.Fatalf("BaseURL = %q, HeartbeatInterval = %d", config.BaseURL, config.HeartbeatInterval)
+	}
+	if config.AuthUser != "" || config.AuthPassword != "" {
+		t.Fatalf("AuthUser = %q, AuthPassword = %q, want no default credentials", config.AuthUser, config.AuthPassword)
+	}
+	if _, ok := os.LookupEnv("RINCON_URL"); ok {
+		t.Fatal("envConfig modified the environment")
+	}
+	if _, err := (&options{config: config}).client(); err == nil || !strings.Contains(err.Error(), "RINCON_USER") {
+		t.Fatalf("client() without credentials: err = %v", err)
+	}
+
+	t.Setenv("RINCON_URL", "http://rincon:10311")
+	t.Setenv("RINCON_USER", "admin")
+	if config, err = envConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if config.BaseURL != "http://rincon:10311" || config.AuthUser != "admin" || config.HeartbeatInterval != 10 {
+		t.Fatalf("BaseURL = %q, AuthUser = %q, HeartbeatInterval = %d", config.BaseURL, config.AuthUser, config.HeartbeatInterval)
+	}
+}
@@ -0,0 +1,304 @@
+package rincon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigFile is the contents of a configuration file loaded with LoadConfig.
+// Besides the client Config, it describes the service to register and the
+// routes it serves.
+type ConfigFile struct {
+	Config  Config
+	Service Service
+	Routes  []Route
+}
+
+// configFile is the JSON layout of a configuration file.
+type configFile struct {
+	BaseURL                  string  `json:"base_url"`
+	HeartbeatMode            string  `json:"heartbeat_mode"`
+	HeartbeatInterval        string  `json:"heartbeat_interval"`
+	HeartbeatMissedThreshold int     `json:"heartbeat_missed_threshold"`
+	AuthUser                 string  `json:"auth_user"`
+	AuthPassword             string  `json:"auth_password"`
+	AuthPasswordFile         string  `json:"auth_password_file"`
+	AdvertiseHost            string  `json:"advertise_host"`
+	AdvertiseScheme          string  `json:"advertise_scheme"`
+	SnapshotPath             string  `json:"snapshot_path"`
+	SnapshotInterval         string  `json:"snapshot_interval"`
+	StateFile                string  `json:"state_file"`
+	Service                  Service `json:"service"`
+	Routes                   []Route `json:"routes"`
+}
+
+// configFileFields maps Config field names to their JSON keys.
+var configFileFields = map[string]string{
+	"BaseURL":                  "base_url",
+	"HeartbeatMode":            "heartbeat_mode",
+	"HeartbeatInterval":        "heartbeat_interval",
+	"HeartbeatMissedThreshold": "heartbeat_missed_threshold",
+	"AdvertiseScheme":          "advertise_scheme",
+	"SnapshotInterval":         "snapshot_interval",
+}
+
+// configEnvFields maps Config field names to their environment variables.
+var configEnvFields = map[string]string{
+	"BaseURL":                  "RINCON_URL",
+	"HeartbeatMode":            "RINCON_HEARTBEAT_MODE",
+	"HeartbeatInterval":        "RINCON_HEARTBEAT_INTERVAL",
+	"HeartbeatMissedThreshold": "RINCON_HEARTBEAT_MISSED_THRESHOLD",
+	"AdvertiseScheme":          "RINCON_ADVERTISE_SCHEME",
+	"SnapshotInterval":         "RINCON_SNAPSHOT_INTERVAL",
+}
+
+// ConfigFromEnv builds a Config from the following environment variables:
+//
+//	RINCON_URL                          BaseURL
+//	RINCON_USER                         AuthUser
+//	RINCON_PASSWORD                     AuthPassword
+//	RINCON_PASSWORD_FILE                file containing AuthPassword
+//	RINCON_HEARTBEAT_MODE               client or server
+//	RINCON_HEARTBEAT_INTERVAL           duration such as 10s, or seconds
+//	RINCON_HEARTBEAT_MISSED_THRESHOLD   HeartbeatMissedThreshold
+//	RINCON_ADVERTISE_HOST               AdvertiseHost
+//	RINCON_ADVERTISE_SCHEME             AdvertiseScheme
+//	RINCON_SNAPSHOT_PATH                SnapshotPath
+//	RINCON_SNAPSHOT_INTERVAL            duration such as 1m, or seconds
+//	RINCON_STATE_FILE                   StateFile
+//
+// It returns a *ConfigError naming the offending variable if a value is
+// invalid or the resulting Config does not pass Validate.
+func ConfigFromEnv() (Config, error) {
+	return ConfigFromEnvDefaults(Config{})
+}
+
+// ConfigFromEnvDefaults is like ConfigFromEnv, but starts from the given
+// Config, so that the fields of unset or empty variables keep their value.
+func ConfigFromEnvDefaults(config Config) (Config, error) {
+	for key, field := range map[string]*string{
+		"RINCON_URL":              &config.BaseURL,
+		"RINCON_USER":             &config.AuthUser,
+		"RINCON_PASSWORD":         &config.AuthPassword,
+		"RINCON_ADVERTISE_HOST":   &config.AdvertiseHost,
+		"RINCON_ADVERTISE_SCHEME": &config.AdvertiseScheme,
+		"RINCON_SNAPSHOT_PATH":    &config.SnapshotPath,
+		"RINCON_STATE_FILE":       &config.StateFile,
+	} {
+		if value := os.Getenv(key); value != "" {
+			*field = value
+		}
+	}
+	if path := os.Getenv("RINCON_PASSWORD_FILE"); path != "" {
+		password, err := readPasswordFile(path)
+		if err != nil {
+			return config, &ConfigError{Field: "RINCON_PASSWORD_FILE", Err: err}
+		}
+		config.AuthPassword = password
+	}
+	if value := os.Getenv("RINCON_HEARTBEAT_MODE"); value != "" {
+		if err := config.HeartbeatMode.UnmarshalText([]byte(value)); err != nil {
+			return config, &ConfigError{Field: "RINCON_HEARTBEAT_MODE", Err: err}
+		}
+	}
+	if value := os.Getenv("RINCON_HEARTBEAT_INTERVAL"); value != "" {
+		interval, err := parseInterval(value)
+		if err != nil {
+			return config, &ConfigError{Field: "RINCON_HEARTBEAT_INTERVAL", Err: err}
+		}
+		config.HeartbeatInterval = interval
+	}
+	if value := os.Getenv("RINCON_HEARTBEAT_MISSED_THRESHOLD"); value != "" {
+		threshold, err := strconv.Atoi(value)
+		if err != nil {
+			return config, &ConfigError{Field: "RINCON_HEARTBEAT_MISSED_THRESHOLD", Err: err}
+		}
+		config.HeartbeatMissedThreshold = threshold
+	}
+	if value := os.Getenv("RINCON_SNAPSHOT_INTERVAL"); value != "" {
+		interval, err := parseInterval(value)
+		if err != nil {
+			return config, &ConfigError{Field: "RINCON_SNAPSHOT_INTERVAL", Err: err}
+		}
+		config.SnapshotInterval = interval
+	}
+	return config, renameConfigError(config.Validate(), configEnvFields)
+}
+
+// LoadConfig reads a JSON configuration file describing the client Config,
+// the service to register and its routes. The heartbeat_interval and
+// snapshot_interval keys take a duration such as "10s", and
+// auth_password_file may be used instead of auth_password. It returns a
+// *ConfigError naming the offending JSON key if a value is invalid.
+func LoadConfig(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := new(configFile)
+	if err = json.Unmarshal(data, raw); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return nil, &ConfigError{Field: typeErr.Field, Err: err}
+		}
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	config := Config{
+		BaseURL:                  raw.BaseURL,
+		HeartbeatMissedThreshold: raw.HeartbeatMissedThreshold,
+		AuthUser:                 raw.AuthUser,
+		AuthPassword:             raw.AuthPassword,
+		AdvertiseHost:            raw.AdvertiseHost,
+		AdvertiseScheme:          raw.AdvertiseScheme,
+		SnapshotPath:             raw.SnapshotPath,
+		StateFile:                raw.StateFile,
+	}
+	if raw.AuthPasswordFile != "" {
+		password, err := readPasswordFile(raw.AuthPasswordFile)
+		if err != nil {
+			return nil, &ConfigError{Field: "auth_password_file", Err: err}
+		}
+		config.AuthPassword = password
+	}
+	if raw.HeartbeatMode != "" {
+		if err := config.HeartbeatMode.UnmarshalText([]byte(raw.HeartbeatMode)); err != nil {
+			return nil, &ConfigError{Field: "heartbeat_mode", Err: err}
+		}
+	}
+	if raw.HeartbeatInterval != "" {
+		interval, err := parseInterval(raw.HeartbeatInterval)
+		if err != nil {
+			return nil, &ConfigError{Field: "heartbeat_interval", Err: err}
+		}
+		config.HeartbeatInterval = interval
+	}
+	if raw.SnapshotInterval != "" {
+		interval, err := parseInterval(raw.SnapshotInterval)
+		if err != nil {
+			return nil, &ConfigError{Field: "snapshot_interval", Err: err}
+		}
+		config.SnapshotInterval = interval
+	}
+	if err = renameConfigError(config.Validate(), configFileFields); err != nil {
+		return nil, err
+	}
+	for i, route := range raw.Routes {
+		if route.Route == "" {
+			return nil, &ConfigError{Field: fmt.Sprintf("routes[%d].route", i), Err: errors.New("must not be empty")}
+		}
+		if _, err := ParseRoutePattern(route.Route, route.Method); err != nil {
+			return nil, &ConfigError{Field: fmt.Sprintf("routes[%d]", i), Err: err}
+		}
+	}
+	return &ConfigFile{
+		Config:  config,
+		Service: raw.Service,
+		Routes:  raw.Routes,
+	}, nil
+}
+
+// Validate checks that the Config can be used to create a Client.
+// It returns a *ConfigError naming the offending Config field.
+func (config Config) Validate() error {
+	if config.BaseURL == "" {
+		return &ConfigError{Field: "BaseURL", Err: errors.New("must not be empty")}
+	}
+	baseURL, err := url.Parse(config.BaseURL)
+	if err != nil {
+		return &ConfigError{Field: "BaseURL", Err: err}
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return &ConfigError{Field: "BaseURL", Err: fmt.Errorf("scheme must be http or https, got %q", baseURL.Scheme)}
+	}
+	if baseURL.Host == "" {
+		return &ConfigError{Field: "BaseURL", Err: errors.New("missing host")}
+	}
+	if config.HeartbeatMode != ServerHeartbeat && config.HeartbeatMode != ClientHeartbeat {
+		return &ConfigError{Field: "HeartbeatMode", Err: fmt.Errorf("unknown heartbeat mode %d", int32(config.HeartbeatMode))}
+	}
+	if config.HeartbeatInterval < 0 {
+		return &ConfigError{Field: "HeartbeatInterval", Err: errors.New("must not be negative")}
+	}
+	if config.HeartbeatMode == ClientHeartbeat && config.HeartbeatInterval == 0 {
+		return &ConfigError{Field: "HeartbeatInterval", Err: errors.New("must be set in client heartbeat mode")}
+	}
+	if config.HeartbeatMissedThreshold < 0 {
+		return &ConfigError{Field: "HeartbeatMissedThreshold", Err: errors.New("must not be negative")}
+	}
+	if config.SnapshotInterval < 0 {
+		return &ConfigError{Field: "SnapshotInterval", Err: errors.New("must not be negative")}
+	}
+	if config.PingInterval < 0 {
+		return &ConfigError{Field: "PingInterval", Err: errors.New("must not be negative")}
+	}
+	if config.DisconnectThreshold < 0 {
+		return &ConfigError{Field: "DisconnectThreshold", Err: errors.New("must not be negative")}
+	}
+	if config.HealthProbeInterval < 0 {
+		return &ConfigError{Field: "HealthProbeInterval", Err: errors.New("must not be negative")}
+	}
+	if _, err := compileRequestPolicies(config.RequestPolicies); err != nil {
+		return &ConfigError{Field: "RequestPolicies", Err: err}
+	}
+	for name, limit := range config.ServiceLimits {
+		if limit.Rate < 0 || limit.Burst < 0 || limit.MaxConcurrent < 0 {
+			return &ConfigError{Field: "ServiceLimits", Err: fmt.Errorf("limit of %s must not be negative", name)}
+		}
+	}
+	if config.BreakerFailureRate < 0 || config.BreakerFailureRate > 1 {
+		return &ConfigError{Field: "BreakerFailureRate", Err: fmt.Errorf("must be between 0 and 1, got %g", config.BreakerFailureRate)}
+	}
+	if config.RetryBudget != nil && *config.RetryBudget < 0 {
+		return &ConfigError{Field: "RetryBudget", Err: errors.New("must not be negative")}
+	}
+	if config.AdvertiseScheme != "" && config.AdvertiseScheme != "http" && config.AdvertiseScheme != "https" {
+		return &ConfigError{Field: "AdvertiseScheme", Err: fmt.Errorf("must be http or https, got %q", config.AdvertiseScheme)}
+	}
+	return nil
+}
+
+// renameConfigError renames the field of a *ConfigError using the given
+// mapping, so that errors name the field as the user wrote it.
+func renameConfigError(err error, names map[string]string) error {
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		if name, ok := names[configErr.Field]; ok {
+			return &ConfigError{Field: name, Err: configErr.Err}
+		}
+	}
+	return err
+}
+
+// parseInterval parses a heartbeat interval given either as a duration
+// such as "10s" or as a whole number of seconds.
+func parseInterval(value string) (int, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, errors.New("must not be negative")
+		}
+		return seconds, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < time.Second || d%time.Second != 0 {
+		return 0, fmt.Errorf("must be a whole number of seconds, got %s", d)
+	}
+	return int(d / time.Second), nil
+}
+
+func readPasswordFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
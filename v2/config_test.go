@@ -0,0 +1,180 @@
+package rincon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(passwordFile, []byte("secret\n"), 0600)
+	t.Setenv("RINCON_URL", "http://rincon:10311")
+	t.Setenv("RINCON_USER", "admin")
+	t.Setenv("RINCON_PASSWORD_FILE", passwordFile)
+	t.Setenv("RINCON_HEARTBEAT_MODE", "Client")
+	t.Setenv("RINCON_HEARTBEAT_INTERVAL", "1m")
+	t.Setenv("RINCON_HEARTBEAT_MISSED_THRESHOLD", "5")
+	t.Setenv("RINCON_SNAPSHOT_INTERVAL", "30")
+
+	config, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.BaseURL != "http://rincon:10311" || config.AuthUser != "admin" || config.AuthPassword != "secret" {
+		t.Errorf("got BaseURL %q, AuthUser %q, AuthPassword %q", config.BaseURL, config.AuthUser, config.AuthPassword)
+	}
+	if config.HeartbeatMode != ClientHeartbeat || config.HeartbeatInterval != 60 || config.HeartbeatMissedThreshold != 5 {
+		t.Errorf("got HeartbeatMode %s, HeartbeatInterval %d, HeartbeatMissedThreshold %d", config.HeartbeatMode, config.HeartbeatInterval, config.HeartbeatMissedThreshold)
+	}
+	if config.SnapshotInterval != 30 {
+		t.Errorf("SnapshotInterval = %d, want 30", config.SnapshotInterval)
+	}
+}
+
+func TestConfigFromEnvDefaults(t *testing.T) {
+	for _, key := range []string{"RINCON_USER", "RINCON_PASSWORD", "RINCON_HEARTBEAT_INTERVAL"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	t.Setenv("RINCON_URL", "http://rincon:10311")
+
+	config, err := ConfigFromEnvDefaults(Config{BaseURL: "http://localhost:10311", AuthUser: "reader", HeartbeatInterval: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.BaseURL != "http://rincon:10311" || config.AuthUser != "reader" || config.HeartbeatInterval != 10 {
+		t.Errorf("got BaseURL %q, AuthUser %q, HeartbeatInterval %d", config.BaseURL, config.AuthUser, config.HeartbeatInterval)
+	}
+}
+
+func TestConfigFromEnvErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		field string
+	}{
+		{"missing url", map[string]string{}, "RINCON_URL"},
+		{"bad scheme", map[string]string{"RINCON_URL": "ftp://rincon"}, "RINCON_URL"},
+		{"bad mode", map[string]string{"RINCON_URL": "http://rincon", "RINCON_HEARTBEAT_MODE": "push"}, "RINCON_HEARTBEAT_MODE"},
+		{"fractional interval", map[string]string{"RINCON_URL": "http://rincon", "RINCON_HEARTBEAT_INTERVAL": "1500ms"}, "RINCON_HEARTBEAT_INTERVAL"},
+		{"client mode without interval", map[string]string{"RINCON_URL": "http://rincon", "RINCON_HEARTBEAT_MODE": "client"}, "RINCON_HEARTBEAT_INTERVAL"},
+		{"bad threshold", map[string]string{"RINCON_URL": "http://rincon", "RINCON_HEARTBEAT_MISSED_THRESHOLD": "x"}, "RINCON_HEARTBEAT_MISSED_THRESHOLD"},
+		{"negative snapshot interval", map[string]string{"RINCON_URL": "http://rincon", "RINCON_SNAPSHOT_INTERVAL": "-1"}, "RINCON_SNAPSHOT_INTERVAL"},
+		{"missing password file", map[string]string{"RINCON_URL": "http://rincon", "RINCON_PASSWORD_FILE": "/nonexistent/password"}, "RINCON_PASSWORD_FILE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"RINCON_URL", "RINCON_HEARTBEAT_MODE", "RINCON_HEARTBEAT_INTERVAL", "RINCON_HEARTBEAT_MISSED_THRESHOLD", "RINCON_SNAPSHOT_INTERVAL", "RINCON_PASSWORD_FILE"} {
+				t.Setenv(key, tt.env[key])
+				if _, ok := tt.env[key]; !ok {
+					os.Unsetenv(key)
+				}
+			}
+			_, err := ConfigFromEnv()
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("err = %v, want a *ConfigError", err)
+			}
+			if configErr.Field != tt.field {
+				t.Fatalf("Field = %q, want %q", configErr.Field, tt.field)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rincon.json")
+	os.WriteFile(path, []byte(`{
+		"base_url": "http://rincon:10311",
+		"heartbeat_mode": "client",
+		"heartbeat_interval": "10s",
+		"service": {"name": "orders", "version": "1.0.0", "endpoint": "http://orders:8080"},
+		"routes": [{"route": "/orders/**", "method": "GET,POST"}]
+	}`), 0600)
+
+	file, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Config.BaseURL != "http://rincon:10311" || file.Config.HeartbeatMode != ClientHeartbeat || file.Config.HeartbeatInterval != 10 {
+		t.Errorf("unexpected config %+v", file.Config)
+	}
+	if file.Service.Name != "orders" || len(file.Routes) != 1 || file.Routes[0].Route != "/orders/**" {
+		t.Errorf("unexpected service %+v and routes %+v", file.Service, file.Routes)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		field string
+	}{
+		{"missing url", `{}`, "base_url"},
+		{"wrong type", `{"base_url": 1}`, "base_url"},
+		{"bad interval", `{"base_url": "http://rincon", "heartbeat_interval": "soon"}`, "heartbeat_interval"},
+		{"empty route", `{"base_url": "http://rincon", "routes": [{"route": ""}]}`, "routes[0].route"},
+		{"invalid route", `{"base_url": "http://rincon", "routes": [{"route": "/a/**/b"}]}`, "routes[0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rincon.json")
+			os.WriteFile(path, []byte(tt.json), 0600)
+			_, err := LoadConfig(path)
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("err = %v, want a *ConfigError", err)
+			}
+			if configErr.Field != tt.field {
+				t.Fatalf("Field = %q, want %q", configErr.Field, tt.field)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Config{BaseURL: "http://rincon:10311"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid config: %s", err)
+	}
+	tests := []struct {
+		field  string
+		config Config
+	}{
+		{"BaseURL", Config{BaseURL: "rincon:10311"}},
+		{"HeartbeatMode", Config{BaseURL: "http://rincon", HeartbeatMode: 7}},
+		{"HeartbeatInterval", Config{BaseURL: "http://rincon", HeartbeatInterval: -1}},
+		{"AdvertiseScheme", Config{BaseURL: "http://rincon", AdvertiseScheme: "grpc"}},
+	}
+	for _, tt := range tests {
+		var configErr *ConfigError
+		if err := tt.config.Validate(); !errors.As(err, &configErr) || configErr.Field != tt.field {
+			t.Errorf("Validate() = %v, want an error for %s", err, tt.field)
+		}
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"10", 10, true},
+		{"10s", 10, true},
+		{"2m", 120, true},
+		{"0", 0, true},
+		{"-1", 0, false},
+		{"500ms", 0, false},
+		{"1.5s", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseInterval(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseInterval(%q) = %d, %v; want %d, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
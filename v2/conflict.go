@@ -0,0 +1,151 @@
+package rincon
+
+import (
+	"fmt"
+)
+
+// ConflictPolicy decides what Register does when the routes being
+// registered conflict with routes owned by other services.
+type ConflictPolicy int32
+
+const (
+	// ConflictForce registers the routes without checking for conflicts.
+	ConflictForce ConflictPolicy = 0
+	// ConflictWarn logs every conflict and registers the routes anyway.
+	ConflictWarn ConflictPolicy = 1
+	// ConflictRefuse returns a *ConflictError instead of registering.
+	ConflictRefuse ConflictPolicy = 2
+)
+
+// ConflictKind describes how two routes conflict.
+type ConflictKind int32
+
+const (
+	// ConflictDuplicate means both routes have the same pattern and at
+	// least one method in common.
+	ConflictDuplicate ConflictKind = 0
+	// ConflictOverlap means the patterns differ, but wildcards let at
+	// least one request match both.
+	ConflictOverlap ConflictKind = 1
+)
+
+func (k ConflictKind) String() string {
+	if k == ConflictDuplicate {
+		return "duplicate"
+	}
+	return "overlap"
+}
+
+// RouteConflict is a desired route that conflicts with a registered route
+// owned by another service.
+type RouteConflict struct {
+	Route    Route
+	Existing Route
+	Kind     ConflictKind
+}
+
+func (rc RouteConflict) String() string {
+	return fmt.Sprintf("%s %s %s conflicts with %s %s owned by %s (%s)",
+		rc.Route.ServiceName, rc.Route.Method, rc.Route.Route,
+		rc.Existing.Method, rc.Existing.Route, rc.Existing.ServiceName, rc.Kind)
+}
+
+// CheckConflicts compares the given routes against every route registered
+// with Rincon and returns the ones owned by other services that are exact
+// duplicates or overlap through wildcards. Routes without a ServiceName
+// are assumed to belong to the client's service.
+func (c *Client) CheckConflicts(routes []Route) ([]RouteConflict, error) {
+	existing, err := c.ListRoutes()
+	if err != nil {
+		return nil, err
+	}
+	conflicts := make([]RouteConflict, 0)
+	for _, route := range routes {
+		if current := c.Service(); route.ServiceName == "" && current != nil {
+			route.ServiceName = current.Name
+		}
+		desired, err := ParseRoutePattern(route.Route, route.Method)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range existing {
+			if other.ServiceName == route.ServiceName {
+				continue
+			}
+			registered, err := ParseRoutePattern(other.Route, other.Method)
+			if err != nil {
+				continue
+			}
+			if !methodsOverlap(desired.Methods, registered.Methods) {
+				continue
+			}
+			conflict := RouteConflict{Route: route, Existing: other}
+			if desired.Route() == registered.Route() {
+				conflict.Kind = ConflictDuplicate
+			} else if segmentsOverlap(desired.Segments, registered.Segments) {
+				conflict.Kind = ConflictOverlap
+			} else {
+				continue
+			}
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts, nil
+}
+
+// applyConflictPolicy checks the routes of the given service for conflicts
+// according to the client's ConflictPolicy.
+func (c *Client) applyConflictPolicy(service Service, routes []Route) error {
+	if c.conflictPolicy == ConflictForce || len(routes) == 0 {
+		return nil
+	}
+	owned := make([]Route, len(routes))
+	for i, route := range routes {
+		route.ServiceName = service.Name
+		owned[i] = route
+	}
+	conflicts, err := c.CheckConflicts(owned)
+	if err != nil {
+		return fmt.Errorf("failed to check route conflicts: %w", err)
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	if c.conflictPolicy == ConflictRefuse {
+		return &ConflictError{Conflicts: conflicts}
+	}
+	for _, conflict := range conflicts {
+		c.logger.Printf("route conflict: %s", conflict)
+	}
+	return nil
+}
+
+// methodsOverlap reports whether two canonical method sets share a method.
+// A nil set means every method.
+func methodsOverlap(a, b []string) bool {
+	if a == nil || b == nil {
+		return true
+	}
+	for _, m := range a {
+		for _, n := range b {
+			if m == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// segmentsOverlap reports whether some request path matches both patterns.
+func segmentsOverlap(a, b []string) bool {
+	if len(a) > 0 && a[0] == "**" || len(b) > 0 && b[0] == "**" {
+		return true
+	}
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	if a[0] != b[0] && a[0] != "*" && b[0] != "*" {
+		return false
+	}
+	return segmentsOverlap(a[1:], b[1:])
+}
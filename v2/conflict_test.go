@@ -0,0 +1,98 @@
+package rincon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSegmentsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"/users", "/users", true},
+		{"/users", "/orders", false},
+		{"/users/*", "/users/me", true},
+		{"/users/*", "/users", false},
+		{"/users/**", "/users", true},
+		{"/users/**", "/users/me/settings", true},
+		{"/*/me", "/users/*", true},
+		{"/*/me", "/users/you", false},
+		{"/**", "/anything/at/all", true},
+		{"/", "/users", false},
+	}
+	for _, tt := range tests {
+		a, _ := ParseRoutePattern(tt.a, "*")
+		b, _ := ParseRoutePattern(tt.b, "*")
+		if got := segmentsOverlap(a.Segments, b.Segments); got != tt.want {
+			t.Errorf("segmentsOverlap(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := segmentsOverlap(b.Segments, a.Segments); got != tt.want {
+			t.Errorf("segmentsOverlap(%s, %s) = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestCheckConflicts(t *testing.T) {
+	f := newFakeRincon(t)
+	other := newTestClient(t, f, Config{})
+	_, err := other.Register(Service{Name: "users", Endpoint: "http://users:8080"}, []Route{
+		{Route: "/users", Method: "GET"},
+		{Route: "/users/*", Method: "DELETE"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient(t, f, Config{})
+
+	conflicts, err := client.CheckConflicts([]Route{
+		{Route: "/users/", Method: "get", ServiceName: "accounts"},
+		{Route: "/users/me", Method: "DELETE", ServiceName: "accounts"},
+		{Route: "/users/me", Method: "GET", ServiceName: "accounts"},
+		{Route: "/users", Method: "GET", ServiceName: "users"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 2 {
+		t.Fatalf("got conflicts %v, want 2", conflicts)
+	}
+	if conflicts[0].Kind != ConflictDuplicate || conflicts[0].Existing.Route != "/users" {
+		t.Errorf("conflicts[0] = %s, want a duplicate of /users", conflicts[0])
+	}
+	if conflicts[1].Kind != ConflictOverlap || conflicts[1].Existing.Route != "/users/*" {
+		t.Errorf("conflicts[1] = %s, want an overlap with /users/*", conflicts[1])
+	}
+}
+
+func TestRegisterConflictPolicy(t *testing.T) {
+	tests := []struct {
+		policy     ConflictPolicy
+		registered bool
+	}{
+		{ConflictForce, true},
+		{ConflictWarn, true},
+		{ConflictRefuse, false},
+	}
+	for _, tt := range tests {
+		f := newFakeRincon(t)
+		other := newTestClient(t, f, Config{})
+		if _, err := other.Register(Service{Name: "users", Endpoint: "http://users:8080"}, []Route{{Route: "/users/**", Method: "*"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		client := newTestClient(t, f, Config{ConflictPolicy: tt.policy})
+		_, err := client.Register(Service{Name: "accounts", Endpoint: "http://accounts:8080"}, []Route{{Route: "/users/me", Method: "GET"}})
+		var conflictErr *ConflictError
+		if tt.registered {
+			if err != nil {
+				t.Errorf("policy %d: %s", tt.policy, err)
+			}
+		} else if !errors.As(err, &conflictErr) || len(conflictErr.Conflicts) != 1 {
+			t.Errorf("policy %d: err = %v, want a *ConflictError with one conflict", tt.policy, err)
+		}
+		if got := len(f.instances("accounts")) == 1; got != tt.registered {
+			t.Errorf("policy %d: registered = %v, want %v", tt.policy, got, tt.registered)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package rincon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConnState is the client's view of whether Rincon is reachable.
+type ConnState int32
+
+const (
+	// Connecting is the state until the first request to Rincon completes.
+	Connecting ConnState = 0
+	// Connected means the last request to Rincon succeeded.
+	Connected ConnState = 1
+	// Degraded means Rincon returned a 5xx status, or requests to it have
+	// started to fail without reaching the DisconnectThreshold.
+	Degraded ConnState = 2
+	// Disconnected means DisconnectThreshold requests in a row could not
+	// reach Rincon. Lookups are served from the Snapshot, if one is loaded,
+	// without calling Rincon, and heartbeats are skipped until a request
+	// or ping succeeds again.
+	Disconnected ConnState = 3
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case Connected:
+		return "connected"
+	case Degraded:
+		return "degraded"
+	case Disconnected:
+		return "disconnected"
+	}
+	return "connecting"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s ConnState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *ConnState) UnmarshalText(text []byte) error {
+	for _, state := range []ConnState{Connecting, Connected, Degraded, Disconnected} {
+		if string(text) == state.String() {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid connection state %q", text)
+}
+
+// connState tracks the ConnState of a client. changed is closed and
+// replaced on every transition, to wake up WaitState.
+type connState struct {
+	mu             sync.Mutex
+	state          ConnState
+	failures       int
+	lastOutcome    time.Time
+	disconnectedAt time.Time
+	changed        chan struct{}
+	subscribers    []chan ConnState
+}
+
+// State returns the current connection state, without calling Rincon.
+func (c *Client) State() ConnState {
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+	return c.conn.state
+}
+
+// WaitState waits until the connection is in the given state or the
+// context is done.
+func (c *Client) WaitState(ctx context.Context, state ConnState) error {
+	for {
+		c.conn.mu.Lock()
+		if c.conn.state == state {
+			c.conn.mu.Unlock()
+			return nil
+		}
+		if c.conn.changed == nil {
+			c.conn.changed = make(chan struct{})
+		}
+		changed := c.conn.changed
+		c.conn.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// StateChanges returns a channel that receives every new connection state.
+// Changes are dropped if the receiver falls more than 16 behind; State
+// always returns the current state.
+func (c *Client) StateChanges() <-chan ConnState {
+	ch := make(chan ConnState, 16)
+	c.conn.mu.Lock()
+	c.conn.subscribers = append(c.conn.subscribers, ch)
+	c.conn.mu.Unlock()
+	return ch
+}
+
+// recordOutcome updates the connection state with the outcome of a request
+// to Rincon: an error if it got no response, or the response status.
+func (c *Client) recordOutcome(status int, err error) {
+	c.conn.mu.Lock()
+	c.conn.lastOutcome = time.Now()
+	var change *connChange
+	switch {
+	case err != nil:
+		c.conn.failures++
+		if c.conn.failures >= c.disconnectThreshold {
+			change = c.setState(Disconnected, err)
+		} else if c.conn.state == Connected {
+			change = c.setState(Degraded, err)
+		}
+	case status >= 500:
+		c.conn.failures = 0
+		change = c.setState(Degraded, nil)
+	default:
+		c.conn.failures = 0
+		change = c.setState(Connected, nil)
+	}
+	c.conn.mu.Unlock()
+	c.announceState(change)
+}
+
+// connChange is a transition made by setState, announced by announceState
+// once the lock is released.
+type connChange struct {
+	state ConnState
+	err   error
+	// recovered is true if the client is Connected again after being
+	// Disconnected for downtime.
+	recovered bool
+	downtime  time.Duration
+}
+
+// setState moves to the given state and wakes up WaitState and
+// StateChanges. Reconnecting after being disconnected marks the client's
+// service to be re-registered by the next heartbeat or watchdog check,
+// since Rincon may have dropped it in the meantime. It returns nil if the
+// state did not change. The caller must hold the lock.
+func (c *Client) setState(state ConnState, err error) *connChange {
+	if c.conn.state == state {
+		return nil
+	}
+	c.conn.state = state
+	if c.conn.changed != nil {
+		close(c.conn.changed)
+		c.conn.changed = nil
+	}
+	for _, ch := range c.conn.subscribers {
+		select {
+		case ch <- state:
+		default:
+		}
+	}
+	change := &connChange{state: state, err: err}
+	if state == Disconnected {
+		c.conn.disconnectedAt = time.Now()
+	} else if state == Connected && !c.conn.disconnectedAt.IsZero() {
+		change.recovered = true
+		change.downtime = time.Since(c.conn.disconnectedAt)
+		c.conn.disconnectedAt = time.Time{}
+		c.reconnected.Store(true)
+	}
+	return change
+}
+
+// announceState logs a transition and calls the OnRinconUnreachable and
+// OnRinconRecovered hooks. In server heartbeat mode without a
+// HeartbeatInterval there is no watchdog to re-register the service after
+// a reconnect, so it is re-registered here instead.
+func (c *Client) announceState(change *connChange) {
+	if change == nil {
+		return
+	}
+	if change.err != nil {
+		c.logger.Printf("rincon is %s: %s", change.state, change.err)
+	} else {
+		c.logger.Printf("rincon is %s", change.state)
+	}
+	if change.state == Disconnected {
+		c.fireRinconUnreachable(change.err)
+	} else if change.recovered {
+		c.fireRinconRecovered(change.downtime)
+		if c.heartbeatMode == ServerHeartbeat && c.heartbeatInterval <= 0 {
+			go c.reregisterAfterReconnect()
+		}
+	}
+}
+
+// reregisterAfterReconnect re-registers the client's service and its
+// routes once the client has reconnected, unless it is not registered or
+// is draining.
+func (c *Client) reregisterAfterReconnect() {
+	service := c.Service()
+	if service == nil || c.IsDraining() || !c.reconnected.Load() {
+		return
+	}
+	if _, err := c.reregister(*service); err != nil {
+		c.logger.Printf("re-registration failed: %s", err)
+	}
+}
+
+// reregister registers the client's service again for a heartbeat or a
+// missed probe. If the client has reconnected since the last registration,
+// its routes are registered again too, and they are retried on the next
+// call if the registration fails.
+func (c *Client) reregister(service Service) (int, error) {
+	routes := []Route{}
+	reconnected := c.reconnected.Swap(false)
+	if reconnected {
+		routes = c.registeredRoutes()
+	}
+	id, err := c.Register(service, routes)
+	if err != nil && reconnected {
+		c.reconnected.Store(true)
+	}
+	return id, err
+}
+
+// runPings pings Rincon once per PingInterval, unless another request to
+// Rincon completed within the last half interval, so that the connection
+// state is kept up to date while the client is idle or disconnected. It
+// runs until the client is closed.
+func (c *Client) runPings() {
+	interval := time.Duration(c.pingInterval) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.conn.mu.Lock()
+			idle := time.Since(c.conn.lastOutcome) >= interval/2
+			c.conn.mu.Unlock()
+			if idle {
+				c.Ping()
+			}
+		}
+	}
+}
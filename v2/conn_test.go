@@ -0,0 +1,201 @@
+package rincon
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConnStateTransitions(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{DisconnectThreshold: 2})
+	if client.State() != Connected {
+		t.Fatalf("State = %s after NewClient, want connected", client.State())
+	}
+	changes := client.StateChanges()
+	disconnected := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		disconnected <- client.WaitState(ctx, Disconnected)
+	}()
+
+	f.fail.Store(true)
+	client.Ping()
+	if client.State() != Degraded {
+		t.Fatalf("State = %s after a 500, want degraded", client.State())
+	}
+	f.fail.Store(false)
+	f.down.Store(true)
+	client.Ping()
+	if client.State() != Degraded {
+		t.Fatalf("State = %s after one failure, want degraded", client.State())
+	}
+	client.Ping()
+	if client.State() != Disconnected {
+		t.Fatalf("State = %s after two failures, want disconnected", client.State())
+	}
+	if err := <-disconnected; err != nil {
+		t.Fatalf("WaitState(Disconnected): %s", err)
+	}
+	f.down.Store(false)
+	client.Ping()
+	if client.State() != Connected {
+		t.Fatalf("State = %s after a ping succeeded, want connected", client.State())
+	}
+
+	for _, want := range []ConnState{Degraded, Disconnected, Connected} {
+		select {
+		case got := <-changes:
+			if got != want {
+				t.Fatalf("StateChanges received %s, want %s", got, want)
+			}
+		default:
+			t.Fatalf("StateChanges did not receive %s", want)
+		}
+	}
+	select {
+	case got := <-changes:
+		t.Fatalf("StateChanges received an extra %s", got)
+	default:
+	}
+}
+
+func TestWaitStateContextDone(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.WaitState(ctx, Disconnected); err != context.DeadlineExceeded {
+		t.Fatalf("WaitState = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestReconnectReregistersRoutes(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{
+		HeartbeatMode:       ServerHeartbeat,
+		HeartbeatInterval:   1,
+		DisconnectThreshold: 1,
+	})
+	id, err := client.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, []Route{{Route: "/orders/**", Method: "GET"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.down.Store(true)
+	client.Ping()
+	if client.State() != Disconnected {
+		t.Fatalf("State = %s, want disconnected", client.State())
+	}
+	// Rincon drops the instance and its routes while the client is away.
+	f.down.Store(false)
+	if err := client.DeregisterByID(id); err != nil {
+		t.Fatal(err)
+	}
+	if client.State() != Connected {
+		t.Fatalf("State = %s, want connected", client.State())
+	}
+
+	deadline := time.After(3 * time.Second)
+	for {
+		routes, err := client.RoutesForService("orders")
+		if err == nil && len(routes) == 1 && routes[0].Route == "/orders/**" && len(f.instances("orders")) == 1 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("the watchdog did not re-register the service and its routes: %+v, %v", routes, err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestReconnectReregistersWithoutWatchdog(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{HeartbeatMode: ServerHeartbeat, DisconnectThreshold: 1})
+	id, err := client.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, []Route{{Route: "/orders/**", Method: "GET"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.down.Store(true)
+	client.Ping()
+	f.down.Store(false)
+	if err := client.DeregisterByID(id); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the service and its routes re-registered", func() bool {
+		routes, err := client.RoutesForService("orders")
+		return err == nil && len(routes) == 1 && len(f.instances("orders")) == 1
+	})
+}
+
+// stateWriter is a log writer that reads the client's state, as a logger
+// shared with code that inspects the client might.
+type stateWriter struct {
+	client atomic.Pointer[Client]
+}
+
+func (w *stateWriter) Write(p []byte) (int, error) {
+	if client := w.client.Load(); client != nil {
+		client.State()
+	}
+	return len(p), nil
+}
+
+func TestStateChangesLoggedOutsideLock(t *testing.T) {
+	f := newFakeRincon(t)
+	writer := new(stateWriter)
+	client := newTestClient(t, f, Config{DisconnectThreshold: 1, Logger: log.New(writer, "", 0)})
+	writer.client.Store(client)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.down.Store(true)
+		client.Ping()
+		f.down.Store(false)
+		client.Ping()
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("logging a state change deadlocked on the connection state lock")
+	}
+}
+
+func TestPingsStopOnClose(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{PingInterval: 1})
+	client.Close()
+	pings := f.count("GET /rincon/ping")
+	time.Sleep(1500 * time.Millisecond)
+	if got := f.count("GET /rincon/ping"); got != pings {
+		t.Fatalf("%d pings after Close, want none", got-pings)
+	}
+}
+
+func TestSnapshotWithoutInstancesFallsThrough(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{DisconnectThreshold: 1})
+	err := client.LoadSnapshot(strings.NewReader(`{
+		"services": [{"id": 7, "name": "orders", "endpoint": "http://orders:8080"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.down.Store(true)
+	client.Ping()
+
+	services, err := client.GetServicesByName("orders")
+	if err != nil || len(services) != 1 || !services[0].Stale {
+		t.Fatalf("orders = %+v, %v, want one stale instance", services, err)
+	}
+	if services, err := client.GetServicesByName("users"); err == nil {
+		t.Fatalf("users = %+v, want the error from Rincon", services)
+	}
+}
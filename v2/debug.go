@@ -0,0 +1,266 @@
+package rincon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// debugHistory is the number of heartbeats and errors kept for the
+// DebugHandler.
+const debugHistory = 20
+
+// debugRoutesTimeout bounds the request for the routes of the client's
+// service, so that the DebugHandler responds while Rincon is slow.
+const debugRoutesTimeout = 2 * time.Second
+
+// DebugEvent is a heartbeat or error shown by the DebugHandler.
+type DebugEvent struct {
+	Time    time.Time `json:"time"`
+	Success bool      `json:"success"`
+	Message string    `json:"message,omitempty"`
+}
+
+// debugState records the client's recent history for the DebugHandler.
+type debugState struct {
+	mu         sync.Mutex
+	heartbeats []DebugEvent
+	errors     []DebugEvent
+}
+
+func appendEvent(events []DebugEvent, event DebugEvent) []DebugEvent {
+	events = append(events, event)
+	if len(events) > debugHistory {
+		events = events[len(events)-debugHistory:]
+	}
+	return events
+}
+
+// recordHeartbeat records a heartbeat sent in client mode or a probe
+// received in server mode.
+func (c *Client) recordHeartbeat(err error) {
+	c.instrumentation.Heartbeat(err)
+	c.fireHeartbeat(err)
+	event := DebugEvent{Time: time.Now(), Success: err == nil}
+	if err != nil {
+		event.Message = err.Error()
+	}
+	c.debug.mu.Lock()
+	c.debug.heartbeats = appendEvent(c.debug.heartbeats, event)
+	c.debug.mu.Unlock()
+}
+
+// recordError records a failed request or operation.
+func (c *Client) recordError(format string, args ...interface{}) {
+	c.debug.mu.Lock()
+	c.debug.errors = appendEvent(c.debug.errors, DebugEvent{Time: time.Now(), Message: fmt.Sprintf(format, args...)})
+	c.debug.mu.Unlock()
+}
+
+// DebugInfo is the state of a client shown by the DebugHandler.
+type DebugInfo struct {
+	Service *Service `json:"service"`
+	Rincon  *Service `json:"rincon"`
+	// RegisteredRoutes are the routes the client registered, and Routes
+	// are the routes Rincon returns for the client's service. RoutesStale
+	// is true if Routes were taken from the Snapshot instead.
+	RegisteredRoutes []Route          `json:"registered_routes"`
+	Routes           []Route          `json:"routes"`
+	RoutesStale      bool             `json:"routes_stale,omitempty"`
+	RoutesError      string           `json:"routes_error,omitempty"`
+	State            ConnState        `json:"state"`
+	HeartbeatMode    string           `json:"heartbeat_mode"`
+	LastProbe        time.Time        `json:"last_probe"`
+	Draining         bool             `json:"draining"`
+	InFlight         int              `json:"in_flight"`
+	Heartbeats       []DebugEvent     `json:"heartbeats"`
+	Snapshot         *Snapshot        `json:"snapshot"`
+	Balancer         string           `json:"balancer"`
+	Traffic          []TrafficStat    `json:"traffic,omitempty"`
+	Breakers         []BreakerStatus  `json:"breakers"`
+	Health           []InstanceHealth `json:"health"`
+	Errors           []DebugEvent     `json:"errors"`
+}
+
+// DebugInfo returns the current state of the client. It asks Rincon for
+// the routes of the client's service, waiting at most two seconds, and
+// reports the error if it fails. While the client is Disconnected, or if
+// Rincon is unreachable, and a Snapshot is loaded, the routes are taken
+// from the snapshot instead.
+func (c *Client) DebugInfo() DebugInfo {
+	return c.debugInfo(context.Background())
+}
+
+func (c *Client) debugInfo(ctx context.Context) DebugInfo {
+	info := DebugInfo{
+		Service:       c.Service(),
+		Rincon:        c.Rincon(),
+		State:         c.State(),
+		HeartbeatMode: c.heartbeatMode.String(),
+		LastProbe:     c.LastProbe(),
+		Draining:      c.IsDraining(),
+		InFlight:      c.InFlight(),
+		Snapshot:      c.currentSnapshot(),
+		Balancer:      fmt.Sprintf("%T", c.balancer),
+		Breakers:      c.BreakerStatus(),
+		Health:        c.InstanceHealth(),
+	}
+	if weighted, ok := c.balancer.(*WeightedBalancer); ok {
+		info.Traffic = weighted.Stats()
+	}
+	if info.Service != nil {
+		info.Routes, info.RoutesStale, info.RoutesError = c.debugRoutes(ctx, info.Service.Name, info.State, info.Snapshot)
+	}
+	info.RegisteredRoutes = c.registeredRoutes()
+	c.debug.mu.Lock()
+	info.Heartbeats = append([]DebugEvent(nil), c.debug.heartbeats...)
+	info.Errors = append([]DebugEvent(nil), c.debug.errors...)
+	c.debug.mu.Unlock()
+	return info
+}
+
+// debugRoutes returns the routes of the named service for DebugInfo, from
+// the snapshot if the client is Disconnected or Rincon is unreachable, and
+// one is loaded.
+func (c *Client) debugRoutes(ctx context.Context, name string, state ConnState, snapshot *Snapshot) ([]Route, bool, string) {
+	if state == Disconnected && snapshot != nil {
+		return snapshotRoutes(snapshot, name), true, ""
+	}
+	routesCtx, cancel := context.WithTimeout(ctx, debugRoutesTimeout)
+	defer cancel()
+	routes, err := c.RoutesForServiceContext(routesCtx, name)
+	if err == nil {
+		return routes, false, ""
+	}
+	// Rincon not answering within debugRoutesTimeout counts as unreachable,
+	// unless the request for the debug page itself was given up.
+	unreachable := isUnreachable(err) || (ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded))
+	if !unreachable || snapshot == nil {
+		return nil, false, err.Error()
+	}
+	return snapshotRoutes(snapshot, name), true, ""
+}
+
+// snapshotRoutes returns the routes of the named service in the snapshot.
+func snapshotRoutes(snapshot *Snapshot, name string) []Route {
+	routes := make([]Route, 0)
+	for _, route := range snapshot.Routes {
+		if route.ServiceName == name {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// DebugHandler returns an http.Handler that shows the state of the client,
+// meant to be served at /debug/rincon. It serves an HTML page, or JSON if
+// the request has ?format=json or accepts application/json.
+func (c *Client) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := c.debugInfo(r.Context())
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(info)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := debugTemplate.Execute(w, info); err != nil {
+			c.logger.Printf("failed to render debug page: %s", err)
+		}
+	})
+}
+
+var debugTemplate = template.Must(template.New("debug").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>/debug/rincon</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.fail { color: #b00; }
+</style>
+</head>
+<body>
+<h1>/debug/rincon</h1>
+<p><a href="?format=json">JSON</a></p>
+
+<h2>Registration</h2>
+<table>
+<tr><th>Service</th><td>{{with .Service}}{{.Name}} {{.Version}} (ID {{.ID}}) at {{.Endpoint}}{{else}}not registered{{end}}</td></tr>
+<tr><th>Rincon</th><td>{{with .Rincon}}{{.Name}} {{.Version}} (ID {{.ID}}) at {{.Endpoint}}{{else}}unknown{{end}}</td></tr>
+<tr><th>Connection</th><td>{{.State}}</td></tr>
+<tr><th>Heartbeat mode</th><td>{{.HeartbeatMode}}</td></tr>
+<tr><th>Last probe</th><td>{{time .LastProbe}}</td></tr>
+<tr><th>Draining</th><td>{{.Draining}}, {{.InFlight}} requests in flight</td></tr>
+</table>
+
+<h2>Routes</h2>
+<table>
+<tr><th>Registered by the client</th><th>Returned by Rincon{{if .RoutesStale}} (from the snapshot){{end}}</th></tr>
+<tr>
+<td>{{range .RegisteredRoutes}}{{.Method}} {{.Route}}<br>{{else}}none{{end}}</td>
+<td>{{if .RoutesError}}<span class="fail">{{.RoutesError}}</span>{{else}}{{range .Routes}}{{.Method}} {{.Route}}<br>{{else}}none{{end}}{{end}}</td>
+</tr>
+</table>
+
+<h2>Heartbeats</h2>
+<table>
+<tr><th>Time</th><th>Result</th></tr>
+{{range .Heartbeats}}<tr><td>{{time .Time}}</td><td>{{if .Success}}ok{{else}}<span class="fail">{{.Message}}</span>{{end}}</td></tr>
+{{else}}<tr><td colspan="2">none</td></tr>
+{{end}}</table>
+
+<h2>Snapshot</h2>
+{{with .Snapshot}}<p>Taken at {{time .TakenAt}}: {{len .Services}} services, {{len .Routes}} routes.</p>
+<table>
+<tr><th>ID</th><th>Name</th><th>Version</th><th>Endpoint</th></tr>
+{{range .Services}}<tr><td>{{.ID}}</td><td>{{.Name}}</td><td>{{.Version}}</td><td>{{.Endpoint}}</td></tr>
+{{end}}</table>
+{{else}}<p>No snapshot loaded.</p>{{end}}
+
+<h2>Balancer</h2>
+<p>{{.Balancer}}</p>
+{{if .Traffic}}<table>
+<tr><th>Service</th><th>Version</th><th>Requests</th></tr>
+{{range .Traffic}}<tr><td>{{.Service}}</td><td>{{.Version}}</td><td>{{.Requests}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>Circuit breakers</h2>
+<table>
+<tr><th>Instance</th><th>Endpoint</th><th>State</th><th>Failures</th><th>Opened at</th></tr>
+{{range .Breakers}}<tr><td>{{.Name}}-{{.ID}}</td><td>{{.Endpoint}}</td><td>{{.State}}</td><td>{{.Failures}}/{{.Requests}}</td><td>{{time .OpenedAt}}</td></tr>
+{{else}}<tr><td colspan="5">none</td></tr>
+{{end}}</table>
+
+<h2>Instance health</h2>
+<table>
+<tr><th>Instance</th><th>Endpoint</th><th>Healthy</th><th>Last probe</th><th>Last error</th></tr>
+{{range .Health}}<tr><td>{{.Name}}-{{.ID}}</td><td>{{.Endpoint}}</td><td>{{.Healthy}}</td><td>{{time .LastProbe}}</td><td>{{.LastError}}</td></tr>
+{{else}}<tr><td colspan="5">none</td></tr>
+{{end}}</table>
+
+<h2>Recent errors</h2>
+<table>
+<tr><th>Time</th><th>Error</th></tr>
+{{range .Errors}}<tr><td>{{time .Time}}</td><td class="fail">{{.Message}}</td></tr>
+{{else}}<tr><td colspan="2">none</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,152 @@
+package rincon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveDebug(t *testing.T, client *Client, r *http.Request) DebugInfo {
+	t.Helper()
+	w := httptest.NewRecorder()
+	client.DebugHandler().ServeHTTP(w, r)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var info DebugInfo
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestDebugHandlerJSON(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	if _, err := client.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, []Route{{Route: "/orders/**", Method: "GET"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	info := serveDebug(t, client, httptest.NewRequest(http.MethodGet, "/debug/rincon?format=json", nil))
+	if info.Service == nil || info.Service.Name != "orders" {
+		t.Fatalf("Service = %+v, want orders", info.Service)
+	}
+	if info.State != Connected {
+		t.Fatalf("State = %s, want connected", info.State)
+	}
+	if len(info.RegisteredRoutes) != 1 || info.RegisteredRoutes[0].Route != "/orders/**" {
+		t.Fatalf("RegisteredRoutes = %+v", info.RegisteredRoutes)
+	}
+	if len(info.Routes) != 1 || info.RoutesStale || info.RoutesError != "" {
+		t.Fatalf("Routes = %+v, stale %v, error %q", info.Routes, info.RoutesStale, info.RoutesError)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/debug/rincon", nil)
+	r.Header.Set("Accept", "application/json")
+	if info := serveDebug(t, client, r); info.Service == nil {
+		t.Fatal("Accept: application/json: expected JSON with the service")
+	}
+}
+
+func TestDebugHandlerHTML(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	if _, err := client.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, []Route{{Route: "/orders/**", Method: "GET"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	client.DebugHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/rincon", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("Content-Type = %q, want text/html", ct)
+	}
+	for _, want := range []string{"orders", "http://orders:8080", "GET /orders/**", "connected"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("page is missing %q", want)
+		}
+	}
+}
+
+func TestDebugHandlerUsesRequestContext(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	if _, err := client.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodGet, "/debug/rincon?format=json", nil).WithContext(ctx)
+	info := serveDebug(t, client, r)
+	if info.RoutesError == "" {
+		t.Fatal("expected a routes error for a canceled request")
+	}
+	if f.count("GET /rincon/services/orders/routes") != 0 {
+		t.Fatal("routes were requested with a canceled context")
+	}
+}
+
+func TestDebugHandlerRoutesFromSnapshotWhenDisconnected(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{DisconnectThreshold: 1})
+	if _, err := client.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	err := client.LoadSnapshot(strings.NewReader(`{
+		"services": [{"id": 2, "name": "orders", "endpoint": "http://orders:8080"}],
+		"routes": [
+			{"route": "/orders/**", "method": "GET", "service_name": "orders"},
+			{"route": "/users/**", "method": "GET", "service_name": "users"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.down.Store(true)
+	client.Ping()
+	if client.State() != Disconnected {
+		t.Fatalf("State = %s, want disconnected", client.State())
+	}
+
+	before := f.count("GET /rincon/services/orders/routes")
+	info := serveDebug(t, client, httptest.NewRequest(http.MethodGet, "/debug/rincon?format=json", nil))
+	if !info.RoutesStale || info.RoutesError != "" {
+		t.Fatalf("RoutesStale = %v, RoutesError = %q, want stale routes", info.RoutesStale, info.RoutesError)
+	}
+	if len(info.Routes) != 1 || info.Routes[0].ServiceName != "orders" {
+		t.Fatalf("Routes = %+v, want the orders route", info.Routes)
+	}
+	if f.count("GET /rincon/services/orders/routes") != before {
+		t.Fatal("routes were requested from Rincon while disconnected")
+	}
+}
+
+func TestDebugHandlerRoutesFromSnapshotWhenUnreachable(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	if _, err := client.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	err := client.LoadSnapshot(strings.NewReader(`{
+		"services": [{"id": 2, "name": "orders", "endpoint": "http://orders:8080"}],
+		"routes": [
+			{"route": "/orders/**", "method": "GET", "service_name": "orders"},
+			{"route": "/users/**", "method": "GET", "service_name": "users"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.down.Store(true)
+
+	info := serveDebug(t, client, httptest.NewRequest(http.MethodGet, "/debug/rincon?format=json", nil))
+	if !info.RoutesStale || info.RoutesError != "" {
+		t.Fatalf("RoutesStale = %v, RoutesError = %q, want stale routes", info.RoutesStale, info.RoutesError)
+	}
+	if len(info.Routes) != 1 || info.Routes[0].ServiceName != "orders" {
+		t.Fatalf("Routes = %+v, want the orders route", info.Routes)
+	}
+}
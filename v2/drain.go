@@ -0,0 +1,99 @@
+package rincon
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// inflight counts the requests being served by the Middleware and signals
+// when the count drops to zero.
+type inflight struct {
+	mu    sync.Mutex
+	count int
+	idle  chan struct{}
+}
+
+func (f *inflight) add(delta int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.idle == nil {
+		f.idle = make(chan struct{})
+	}
+	f.count += delta
+	if f.count == 0 {
+		close(f.idle)
+		f.idle = make(chan struct{})
+	}
+}
+
+// wait returns a channel that is closed once no requests are in flight.
+func (f *inflight) wait() <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.count == 0 {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return f.idle
+}
+
+func (f *inflight) current() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.count
+}
+
+// Middleware returns an http.Handler that tracks the requests in flight
+// through next, so that Drain can wait for them to finish.
+func (c *Client) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.inflight.add(1)
+		defer c.inflight.add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// InFlight returns the number of requests currently being served through
+// the client's Middleware.
+func (c *Client) InFlight() int {
+	return c.inflight.current()
+}
+
+// IsDraining returns true if Drain has been called since the client last
+// registered.
+func (c *Client) IsDraining() bool {
+	return c.draining.Load()
+}
+
+// Drain gracefully removes the client's registration. It stops the
+// heartbeat, makes the HealthHandler report the service as draining,
+// and waits until the requests tracked by Middleware have finished or
+// the grace period expires, whichever comes first. The client is then
+// deregistered. If the context is done before the requests finish, the
+// client is still deregistered and the context's error is returned.
+func (c *Client) Drain(ctx context.Context, grace time.Duration) error {
+	c.draining.Store(true)
+	if c.heartbeatMode == ClientHeartbeat {
+		c.StopHeartbeat()
+	}
+	c.stopWatchdog()
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	var ctxErr error
+	select {
+	case <-c.inflight.wait():
+	case <-timer.C:
+		c.logger.Printf("drain grace period of %s expired with %d requests in flight", grace, c.InFlight())
+	case <-ctx.Done():
+		ctxErr = ctx.Err()
+	}
+
+	if err := c.Deregister(); err != nil {
+		return err
+	}
+	return ctxErr
+}
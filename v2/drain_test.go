@@ -0,0 +1,129 @@
+package rincon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// registerDrainable registers a client and returns it with a Middleware
+// wrapped handler that blocks until release is closed.
+func registerDrainable(t *testing.T) (*fakeRincon, *Client, http.Handler, chan struct{}) {
+	t.Helper()
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	if _, err := client.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	return f, client, handler, release
+}
+
+func TestDrainWaitsForInFlightRequests(t *testing.T) {
+	f, client, handler, release := registerDrainable(t)
+	served := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		close(served)
+	}()
+	eventually(t, "the request to be in flight", func() bool { return client.InFlight() == 1 })
+
+	drained := make(chan error, 1)
+	go func() { drained <- client.Drain(context.Background(), time.Minute) }()
+	eventually(t, "the client to drain", client.IsDraining)
+
+	rec := httptest.NewRecorder()
+	client.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("health status while draining = %d, want 503", rec.Code)
+	}
+	select {
+	case err := <-drained:
+		t.Fatalf("Drain returned %v with a request in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if len(f.instances("orders")) != 1 {
+		t.Fatal("deregistered before the request finished")
+	}
+
+	close(release)
+	<-served
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+	if len(f.instances("orders")) != 0 || client.IsRegistered() {
+		t.Fatal("still registered after Drain")
+	}
+}
+
+func TestDrainGracePeriodExpires(t *testing.T) {
+	f, client, handler, release := registerDrainable(t)
+	defer close(release)
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	eventually(t, "the request to be in flight", func() bool { return client.InFlight() == 1 })
+
+	if err := client.Drain(context.Background(), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.instances("orders")) != 0 {
+		t.Fatal("still registered after the grace period expired")
+	}
+}
+
+func TestDrainContextCanceled(t *testing.T) {
+	f, client, handler, release := registerDrainable(t)
+	defer close(release)
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	eventually(t, "the request to be in flight", func() bool { return client.InFlight() == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.Drain(ctx, time.Minute); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if len(f.instances("orders")) != 0 {
+		t.Fatal("still registered after the context was done")
+	}
+}
+
+func TestRegisterClearsDraining(t *testing.T) {
+	_, client, _, _ := registerDrainable(t)
+	if err := client.Drain(context.Background(), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if client.IsDraining() {
+		t.Fatal("still draining after registering again")
+	}
+}
+
+func TestDeregisterContextCanceled(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{HeartbeatMode: ClientHeartbeat, HeartbeatInterval: 60})
+	if _, err := client.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.DeregisterContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("DeregisterContext with a canceled context = %v, want context.Canceled", err)
+	}
+	if !client.IsRegistered() {
+		t.Fatal("a failed DeregisterContext cleared the registration")
+	}
+	if err := client.DeregisterContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if client.IsRegistered() || len(f.instances("orders")) != 0 {
+		t.Fatal("DeregisterContext did not deregister")
+	}
+}
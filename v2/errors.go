@@ -1,7 +1,73 @@
 package rincon
 
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoInstances is returned by a Balancer when there is no instance
+// to pick from.
+var ErrNoInstances = errors.New("no instances available")
+
+// ErrCircuitOpen is returned when the circuit breakers of every instance
+// of a service are open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrDisconnected is passed to the heartbeat hooks when a heartbeat is
+// skipped because the client is Disconnected from Rincon.
+var ErrDisconnected = errors.New("rincon is disconnected")
+
 // ErrorResponse is a struct to help decode errors from the Rincon API.
 type ErrorResponse struct {
 	StatusCode int    `json:"-"`
 	Message    string `json:"message"`
 }
+
+// ConfigError describes an invalid configuration field. Field is named
+// as it appears in the source of the configuration, such as the
+// environment variable or the JSON key.
+type ConfigError struct {
+	Field string
+	Err   error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// LimitError is returned by a Transport and Call when a request exceeds
+// the ServiceLimit of its service. Limit is "rate" or "concurrency", and
+// Err is the context's error if the request gave up waiting.
+type LimitError struct {
+	Service string
+	Limit   string
+	Err     error
+}
+
+func (e *LimitError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s limit of %s exceeded: %s", e.Limit, e.Service, e.Err)
+	}
+	return fmt.Sprintf("%s limit of %s exceeded", e.Limit, e.Service)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// ConflictError is returned by Register when the ConflictPolicy is
+// ConflictRefuse and the routes conflict with routes of other services.
+type ConflictError struct {
+	Conflicts []RouteConflict
+}
+
+func (e *ConflictError) Error() string {
+	if len(e.Conflicts) == 1 {
+		return "route conflict: " + e.Conflicts[0].String()
+	}
+	return fmt.Sprintf("%d route conflicts, first: %s", len(e.Conflicts), e.Conflicts[0])
+}
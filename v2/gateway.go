@@ -0,0 +1,161 @@
+package rincon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+)
+
+// MatchedRouteHeader is the response header set by the Gateway to the
+// method set and pattern of the route that matched the request.
+const MatchedRouteHeader = "X-Rincon-Matched-Route"
+
+// MatchedServiceHeader is the response header set by the Gateway to the
+// name and ID of the service instance the request was proxied to.
+const MatchedServiceHeader = "X-Rincon-Service"
+
+// Gateway is an http.Handler that proxies each request to the Endpoint of
+// the service Rincon matches for its path and method. The matched route is
+// explained with MatchRouteDetailed and reported in the MatchedRouteHeader
+// of the response. The instance is picked by the client's Balancer from the
+// instances of the service, which are looked up as for a Transport, and
+// the newest version is preferred by default. Instances ejected by the
+// health prober or whose circuit breaker is open are skipped, the
+// outcome of every proxied request is counted by the breaker, and requests
+// that match a RequestPolicy are hedged and retried on other instances.
+// The W3C traceparent and tracestate of the request are propagated to the
+// Rincon match request and to the proxied request.
+type Gateway struct {
+	// KeyHeader is the request header whose value is passed to the
+	// Balancer as the request key, so that requests with the same value
+	// stick to the same version or instance.
+	KeyHeader string
+	// KeyCookie is the cookie used as the request key when the KeyHeader
+	// is not set on the request.
+	KeyCookie string
+
+	client *Client
+	proxy  *httputil.ReverseProxy
+}
+
+type gatewayTargetKey struct{}
+
+// gatewayTarget is the service a request is proxied to. The instance
+// that answered is filled in by the gateway's transport.
+type gatewayTarget struct {
+	name      string
+	instances []Service
+	key       string
+	service   *Service
+}
+
+// gatewayTransport sends proxied requests to an instance of the target
+// service.
+type gatewayTransport struct {
+	client *Client
+}
+
+func (t *gatewayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := req.Context().Value(gatewayTargetKey{}).(*gatewayTarget)
+	resp, service, err := t.client.roundTrip(http.DefaultTransport, req, target.name, target.instances, target.key)
+	target.service = service
+	return resp, err
+}
+
+// NewGateway returns a Gateway that routes requests using the given client.
+func NewGateway(client *Client) *Gateway {
+	g := &Gateway{client: client}
+	g.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			target := r.In.Context().Value(gatewayTargetKey{}).(*gatewayTarget)
+			r.Out.URL.Scheme = "rincon"
+			r.Out.URL.Host = target.name
+			r.Out.Host = ""
+			r.SetXForwarded()
+		},
+		Transport: &gatewayTransport{client: client},
+		ModifyResponse: func(resp *http.Response) error {
+			target := resp.Request.Context().Value(gatewayTargetKey{}).(*gatewayTarget)
+			resp.Header.Set(MatchedServiceHeader, fmt.Sprintf("%s-%d", target.service.Name, target.service.ID))
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrNoInstances) {
+				writeGatewayError(w, http.StatusServiceUnavailable, err.Error())
+				return
+			}
+			g.client.logger.Printf("gateway: proxy to %s failed: %s", r.URL.Host, err)
+			writeGatewayError(w, http.StatusBadGateway, "upstream service unavailable")
+		},
+	}
+	return g
+}
+
+// ServeHTTP implements http.Handler.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if tc, ok := TraceFromRequest(r); ok {
+		r = r.WithContext(ContextWithTrace(r.Context(), tc))
+	}
+	result, apiError, err := g.client.matchRouteDetailed(r.Context(), r.URL.Path, r.Method)
+	if err != nil || apiError != nil {
+		writeMatchError(w, apiError, err)
+		return
+	}
+	if result.Route.Route != "" {
+		w.Header().Set(MatchedRouteHeader, result.Route.Method+" "+result.Route.Route)
+	}
+	instances, err := g.client.lookupInstances(r.Context(), result.Service.Name)
+	if err != nil {
+		writeMatchError(w, nil, err)
+		return
+	}
+	target := &gatewayTarget{
+		name:      result.Service.Name,
+		instances: instances,
+		key:       g.requestKey(r),
+	}
+	ctx := context.WithValue(r.Context(), gatewayTargetKey{}, target)
+	g.proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// writeMatchError responds to a request that could not be matched, given
+// the error response from Rincon or the error of the request. Only a
+// request that no route matches is answered with 404; Rincon being
+// unreachable is answered with 503 and any other failure with 502.
+func writeMatchError(w http.ResponseWriter, apiError *ErrorResponse, err error) {
+	switch {
+	case err != nil && isUnreachable(err):
+		writeGatewayError(w, http.StatusServiceUnavailable, "rincon is unreachable")
+	case err != nil:
+		writeGatewayError(w, http.StatusBadGateway, err.Error())
+	case apiError.StatusCode == http.StatusNotFound:
+		writeGatewayError(w, http.StatusNotFound, apiError.Message)
+	default:
+		writeGatewayError(w, http.StatusBadGateway, fmt.Sprintf("[%d] %s", apiError.StatusCode, apiError.Message))
+	}
+}
+
+// requestKey returns the balancing key of the request from the KeyHeader
+// or KeyCookie, or an empty string if neither is present.
+func (g *Gateway) requestKey(r *http.Request) string {
+	if g.KeyHeader != "" {
+		if key := r.Header.Get(g.KeyHeader); key != "" {
+			return key
+		}
+	}
+	if g.KeyCookie != "" {
+		if cookie, err := r.Cookie(g.KeyCookie); err == nil {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func writeGatewayError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Message: message})
+}
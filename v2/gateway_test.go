@@ -0,0 +1,110 @@
+package rincon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestGateway registers a backend as the "orders" service and returns
+// a Gateway routing to it.
+func newTestGateway(t *testing.T, f *fakeRincon, config Config) *Gateway {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	t.Cleanup(backend.Close)
+	owner := newTestClient(t, f, Config{})
+	if _, err := owner.Register(Service{Name: "orders", Endpoint: backend.URL}, []Route{{Route: "/orders/**", Method: "GET"}}); err != nil {
+		t.Fatal(err)
+	}
+	return NewGateway(newTestClient(t, f, config))
+}
+
+func TestGatewayProxiesMatchedRequests(t *testing.T) {
+	for _, snapshot := range []bool{false, true} {
+		f := newFakeRincon(t)
+		config := Config{}
+		if snapshot {
+			config.SnapshotInterval = 60
+		}
+		gateway := newTestGateway(t, f, config)
+
+		rec := httptest.NewRecorder()
+		gateway.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/7", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != "/orders/7" {
+			t.Fatalf("snapshot %v: got %d %q", snapshot, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get(MatchedRouteHeader); got != "GET /orders/**" {
+			t.Errorf("snapshot %v: %s = %q, want %q", snapshot, MatchedRouteHeader, got, "GET /orders/**")
+		}
+		if got := rec.Header().Get(MatchedServiceHeader); got != "orders-2" {
+			t.Errorf("snapshot %v: %s = %q, want %q", snapshot, MatchedServiceHeader, got, "orders-2")
+		}
+	}
+}
+
+func TestGatewayReusesFetchedRoutes(t *testing.T) {
+	f := newFakeRincon(t)
+	gateway := newTestGateway(t, f, Config{})
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		gateway.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/7", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got %d %q", rec.Code, rec.Body.String())
+		}
+	}
+	if got := f.count("GET /rincon/routes"); got != 1 {
+		t.Fatalf("fetched the routes %d times for 3 requests, want 1", got)
+	}
+}
+
+func TestGatewayMatchErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		down   bool
+		fail   bool
+		status int
+	}{
+		{"no route", "/users/1", false, false, http.StatusNotFound},
+		{"rincon error", "/orders/1", false, true, http.StatusBadGateway},
+		{"rincon unreachable", "/orders/1", true, false, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeRincon(t)
+			gateway := newTestGateway(t, f, Config{})
+			f.down.Store(tt.down)
+			f.fail.Store(tt.fail)
+
+			rec := httptest.NewRecorder()
+			gateway.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGatewayBalancesInstances(t *testing.T) {
+	f := newFakeRincon(t)
+	newBackend(t, f, "first", 0)
+	newBackend(t, f, "second", 0)
+	owner := newTestClient(t, f, Config{})
+	if _, err := owner.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, []Route{{Route: "/orders/**", Method: "GET"}}); err != nil {
+		t.Fatal(err)
+	}
+	f.drop(owner.Service().ID)
+	gateway := NewGateway(newTestClient(t, f, Config{}))
+
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		gateway.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/1", nil))
+		seen[rec.Body.String()] = true
+	}
+	if !seen["first"] || !seen["second"] {
+		t.Fatalf("responses came from %v, want both instances", seen)
+	}
+}
@@ -0,0 +1,58 @@
+package rincon
+
+import "hash/fnv"
+
+// ConsistentHashBalancer is a Balancer that sends requests with the same
+// key to the same instance, using rendezvous hashing over the instance
+// endpoints. When an instance is added or removed, only the keys assigned
+// to that instance move. Requests without a key are passed to the fallback
+// Balancer. With a Gateway, the key is taken from its KeyHeader or
+// KeyCookie, and with a Transport from its KeyHeader.
+type ConsistentHashBalancer struct {
+	fallback Balancer
+}
+
+// NewConsistentHashBalancer returns a ConsistentHashBalancer. If fallback is
+// nil, a NewestVersionBalancer is used for requests without a key.
+func NewConsistentHashBalancer(fallback Balancer) *ConsistentHashBalancer {
+	if fallback == nil {
+		fallback = &NewestVersionBalancer{}
+	}
+	return &ConsistentHashBalancer{fallback: fallback}
+}
+
+// Pick implements Balancer.
+func (b *ConsistentHashBalancer) Pick(instances []Service, key string) (*Service, error) {
+	if len(instances) == 0 {
+		return nil, ErrNoInstances
+	}
+	if key == "" {
+		return b.fallback.Pick(instances, key)
+	}
+	best := 0
+	var bestScore uint64
+	for i, instance := range instances {
+		score := rendezvousScore(key, instance.Endpoint)
+		if i == 0 || score > bestScore || score == bestScore && instance.Endpoint < instances[best].Endpoint {
+			best, bestScore = i, score
+		}
+	}
+	return &instances[best], nil
+}
+
+// rendezvousScore returns the weight of the instance for the key. The FNV
+// hash is passed through a finalizer, since FNV alone distributes similar
+// endpoints poorly.
+func rendezvousScore(key, endpoint string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(endpoint))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
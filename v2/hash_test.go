@@ -0,0 +1,79 @@
+package rincon
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func hashInstances(n int) []Service {
+	instances := make([]Service, n)
+	for i := range instances {
+		instances[i] = Service{ID: i + 1, Name: "orders", Version: "1.0.0", Endpoint: fmt.Sprintf("http://10.0.0.%d:8080", i+1)}
+	}
+	return instances
+}
+
+func TestConsistentHashBalancerDistribution(t *testing.T) {
+	b := NewConsistentHashBalancer(nil)
+	instances := hashInstances(5)
+	const keys = 10000
+	counts := make(map[int]int)
+	for i := 0; i < keys; i++ {
+		service, err := b.Pick(instances, "user-"+strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[service.ID]++
+	}
+	for _, instance := range instances {
+		if share := float64(counts[instance.ID]) / keys; math.Abs(share-0.2) > 0.03 {
+			t.Errorf("instance %d got %.3f of the keys, want 0.2", instance.ID, share)
+		}
+	}
+}
+
+func TestConsistentHashBalancerStability(t *testing.T) {
+	b := NewConsistentHashBalancer(nil)
+	instances := hashInstances(5)
+	// Shuffling the instances does not move any key.
+	reversed := make([]Service, len(instances))
+	for i := range instances {
+		reversed[len(instances)-1-i] = instances[i]
+	}
+	// Removing an instance only moves the keys it owned.
+	removed := instances[2]
+	remaining := append(append([]Service{}, instances[:2]...), instances[3:]...)
+
+	for i := 0; i < 1000; i++ {
+		key := "user-" + strconv.Itoa(i)
+		before, _ := b.Pick(instances, key)
+		if again, _ := b.Pick(reversed, key); again.ID != before.ID {
+			t.Fatalf("key %s moved from %d to %d when the order changed", key, before.ID, again.ID)
+		}
+		after, _ := b.Pick(remaining, key)
+		if before.ID != removed.ID && after.ID != before.ID {
+			t.Fatalf("key %s moved from %d to %d when %d was removed", key, before.ID, after.ID, removed.ID)
+		}
+	}
+}
+
+func TestConsistentHashBalancerWithoutKey(t *testing.T) {
+	b := NewConsistentHashBalancer(nil)
+	instances := hashInstances(2)
+	seen := make(map[int]bool)
+	for i := 0; i < 4; i++ {
+		service, err := b.Pick(instances, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[service.ID] = true
+	}
+	if len(seen) != 2 {
+		t.Fatalf("picked %v without a key, want the fallback to round robin", seen)
+	}
+	if _, err := b.Pick(nil, "key"); err != ErrNoInstances {
+		t.Fatalf("err = %v, want ErrNoInstances", err)
+	}
+}
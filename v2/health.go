@@ -0,0 +1,218 @@
+package rincon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InstanceHealth is the health of a discovered service instance as seen by
+// the client's health prober.
+type InstanceHealth struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint"`
+	// HealthCheck is the URL probed by the prober.
+	HealthCheck string `json:"health_check"`
+	// Healthy is false once the instance failed UnhealthyThreshold probes
+	// in a row, until it passes HealthyThreshold probes in a row after
+	// its cool-down.
+	Healthy bool `json:"healthy"`
+	// EjectedUntil is the end of the cool-down during which the instance
+	// is not probed. It is the zero time if the instance is not ejected.
+	EjectedUntil time.Time `json:"ejected_until"`
+	Successes    int       `json:"successes"`
+	Failures     int       `json:"failures"`
+	LastProbe    time.Time `json:"last_probe"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// healthProber tracks the instances returned by service lookups and the
+// results of probing their HealthCheck.
+type healthProber struct {
+	mu        sync.Mutex
+	instances map[string]map[int]*InstanceHealth
+}
+
+// observeInstances records the instances of a service returned by a lookup,
+// forgetting instances of that service that are no longer registered.
+func (c *Client) observeInstances(name string, services []Service) {
+	if c.healthProbeInterval <= 0 {
+		return
+	}
+	p := &c.prober
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.instances == nil {
+		p.instances = make(map[string]map[int]*InstanceHealth)
+	}
+	previous := p.instances[name]
+	current := make(map[int]*InstanceHealth, len(services))
+	for _, service := range services {
+		if health, ok := previous[service.ID]; ok && health.Endpoint == service.Endpoint {
+			health.HealthCheck = service.HealthCheck
+			current[service.ID] = health
+			continue
+		}
+		current[service.ID] = &InstanceHealth{
+			ID:          service.ID,
+			Name:        service.Name,
+			Endpoint:    service.Endpoint,
+			HealthCheck: service.HealthCheck,
+			Healthy:     true,
+		}
+	}
+	p.instances[name] = current
+}
+
+// healthyInstances removes the instances ejected by the health prober. If
+// every instance is ejected, all of them are returned, so that a failing
+// prober does not take a whole service out of rotation.
+func (c *Client) healthyInstances(instances []Service) []Service {
+	if c.healthProbeInterval <= 0 || len(instances) == 0 {
+		return instances
+	}
+	p := &c.prober
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	healthy := make([]Service, 0, len(instances))
+	for _, instance := range instances {
+		if health, ok := p.instances[instance.Name][instance.ID]; ok && !health.Healthy {
+			continue
+		}
+		healthy = append(healthy, instance)
+	}
+	if len(healthy) == 0 {
+		return instances
+	}
+	return healthy
+}
+
+// InstanceHealth returns the health of every discovered instance, sorted
+// by service name and ID. It is empty unless HealthProbeInterval is set.
+func (c *Client) InstanceHealth() []InstanceHealth {
+	p := &c.prober
+	p.mu.Lock()
+	health := make([]InstanceHealth, 0)
+	for _, instances := range p.instances {
+		for _, instance := range instances {
+			health = append(health, *instance)
+		}
+	}
+	p.mu.Unlock()
+	sort.Slice(health, func(i, j int) bool {
+		if health[i].Name != health[j].Name {
+			return health[i].Name < health[j].Name
+		}
+		return health[i].ID < health[j].ID
+	})
+	return health
+}
+
+// runHealthProber probes the HealthCheck of every discovered instance once
+// per HealthProbeInterval until the client is closed.
+func (c *Client) runHealthProber() {
+	ticker := time.NewTicker(time.Duration(c.healthProbeInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.probeInstances()
+		}
+	}
+}
+
+// probeInstances probes every discovered instance that is not cooling down
+// and has a HealthCheck, concurrently.
+func (c *Client) probeInstances() {
+	now := time.Now()
+	targets := make([]Service, 0)
+	p := &c.prober
+	p.mu.Lock()
+	for _, instances := range p.instances {
+		for _, health := range instances {
+			if health.HealthCheck == "" || now.Before(health.EjectedUntil) {
+				continue
+			}
+			targets = append(targets, Service{
+				ID:          health.ID,
+				Name:        health.Name,
+				Endpoint:    health.Endpoint,
+				HealthCheck: health.HealthCheck,
+			})
+		}
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, service := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, err := c.checkHealth(context.Background(), service)
+			if err == nil && status >= 500 {
+				err = fmt.Errorf("health check returned %d", status)
+			}
+			c.recordHealth(service, err)
+		}()
+	}
+	wg.Wait()
+}
+
+// recordHealth applies the result of a probe. An instance is ejected for
+// the HealthProbeCooldown once UnhealthyThreshold probes in a row fail, and
+// returns to selection once HealthyThreshold probes in a row succeed.
+func (c *Client) recordHealth(service Service, err error) {
+	p := &c.prober
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	health, ok := p.instances[service.Name][service.ID]
+	if !ok {
+		return
+	}
+	health.LastProbe = time.Now()
+	if err != nil {
+		health.LastError = err.Error()
+		health.Successes = 0
+		health.Failures++
+		if !health.Healthy || health.Failures >= c.unhealthyThreshold {
+			if health.Healthy {
+				c.logger.Printf("ejecting %s-%d after %d failed health checks: %s", service.Name, service.ID, health.Failures, err)
+			}
+			health.Healthy = false
+			health.EjectedUntil = health.LastProbe.Add(time.Duration(c.healthProbeCooldown) * time.Second)
+		}
+		return
+	}
+	health.LastError = ""
+	health.Failures = 0
+	health.Successes++
+	health.EjectedUntil = time.Time{}
+	if !health.Healthy && health.Successes >= c.healthyThreshold {
+		c.logger.Printf("restoring %s-%d after %d passed health checks", service.Name, service.ID, health.Successes)
+		health.Healthy = true
+	}
+}
+
+// checkHealth requests the HealthCheck of the service and returns the
+// response status.
+func (c *Client) checkHealth(ctx context.Context, service Service) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, service.HealthCheck, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", c.currentUserAgent())
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,111 @@
+package rincon
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newProbedService adds an instance whose health check responds with the
+// returned status, and counts the probes it receives.
+func newProbedService(t *testing.T, f *fakeRincon) (Service, *atomic.Int32, *atomic.Int32) {
+	t.Helper()
+	var status, probes atomic.Int32
+	status.Store(http.StatusOK)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(backend.Close)
+	service := f.add(Service{Name: "orders", Endpoint: backend.URL, HealthCheck: backend.URL + "/health"})
+	return service, &status, &probes
+}
+
+func TestHealthProberEjectsAndRestores(t *testing.T) {
+	f := newFakeRincon(t)
+	unstable, status, _ := newProbedService(t, f)
+	stable, _, _ := newProbedService(t, f)
+	// A long interval keeps the prober loop out of the way, so probes are
+	// only run by the test.
+	client := newTestClient(t, f, Config{
+		HealthProbeInterval: 3600,
+		UnhealthyThreshold:  2,
+		HealthyThreshold:    2,
+		HealthProbeCooldown: 1,
+	})
+	if _, err := client.GetServicesByName("orders"); err != nil {
+		t.Fatal(err)
+	}
+	healthy := func() map[int]bool {
+		result := make(map[int]bool)
+		for _, health := range client.InstanceHealth() {
+			result[health.ID] = health.Healthy
+		}
+		return result
+	}
+
+	status.Store(http.StatusInternalServerError)
+	client.probeInstances()
+	if !healthy()[unstable.ID] {
+		t.Fatal("ejected after a single failure")
+	}
+	client.probeInstances()
+	if healthy()[unstable.ID] || !healthy()[stable.ID] {
+		t.Fatalf("health = %v, want only %d ejected", healthy(), unstable.ID)
+	}
+	for i := 0; i < 5; i++ {
+		service, err := client.PickService("orders", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if service.ID == unstable.ID {
+			t.Fatal("picked the ejected instance")
+		}
+	}
+
+	// The instance is not probed again until its cool-down ends.
+	status.Store(http.StatusOK)
+	client.probeInstances()
+	if health := client.InstanceHealth()[0]; health.Successes != 0 {
+		t.Fatalf("probed during the cool-down: %+v", health)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	client.probeInstances()
+	if healthy()[unstable.ID] {
+		t.Fatal("restored after a single success")
+	}
+	client.probeInstances()
+	if !healthy()[unstable.ID] {
+		t.Fatal("not restored after HealthyThreshold successes")
+	}
+}
+
+func TestHealthyInstancesKeepsAllWhenAllEjected(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{HealthProbeInterval: 3600, UnhealthyThreshold: 1})
+	instances := []Service{{ID: 7, Name: "orders"}, {ID: 8, Name: "orders"}}
+	client.observeInstances("orders", instances)
+	for _, instance := range instances {
+		client.recordHealth(instance, errors.New("refused"))
+	}
+	if got := client.healthyInstances(instances); len(got) != 2 {
+		t.Fatalf("healthyInstances = %v, want every instance when all are ejected", got)
+	}
+}
+
+func TestCloseStopsHealthProber(t *testing.T) {
+	f := newFakeRincon(t)
+	_, _, probes := newProbedService(t, f)
+	client := newTestClient(t, f, Config{HealthProbeInterval: 1})
+	if _, err := client.GetServicesByName("orders"); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	time.Sleep(1500 * time.Millisecond)
+	if got := probes.Load(); got != 0 {
+		t.Fatalf("got %d probes after Close", got)
+	}
+}
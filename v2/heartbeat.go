@@ -2,7 +2,7 @@ package rincon
 
 import (
 	"fmt"
-	"log"
+	"strings"
 	"time"
 )
 
@@ -13,7 +13,39 @@ const (
 	ClientHeartbeat HeartbeatMode = 1
 )
 
-var heartbeatTicker *time.Ticker
+// String returns the name of the heartbeat mode, either "server" or "client".
+func (m HeartbeatMode) String() string {
+	switch m {
+	case ServerHeartbeat:
+		return "server"
+	case ClientHeartbeat:
+		return "client"
+	default:
+		return fmt.Sprintf("HeartbeatMode(%d)", int32(m))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m HeartbeatMode) MarshalText() ([]byte, error) {
+	if m != ServerHeartbeat && m != ClientHeartbeat {
+		return nil, fmt.Errorf("unknown heartbeat mode %d", int32(m))
+	}
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It accepts "server"
+// and "client" in any case.
+func (m *HeartbeatMode) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "server":
+		*m = ServerHeartbeat
+	case "client":
+		*m = ClientHeartbeat
+	default:
+		return fmt.Errorf("unknown heartbeat mode %q, expected client or server", text)
+	}
+	return nil
+}
 
 // StartHeartbeat starts the heartbeat for the client.
 // If the client is in server heartbeat mode, it will return an error.
@@ -22,10 +54,14 @@ func (c *Client) StartHeartbeat() error {
 	if c.heartbeatMode == ServerHeartbeat {
 		return fmt.Errorf("client is in server heartbeat mode")
 	}
-	if heartbeatTicker != nil {
+	c.heartbeatMu.Lock()
+	defer c.heartbeatMu.Unlock()
+	if c.heartbeatTicker != nil {
 		return fmt.Errorf("heartbeat already active")
 	}
-	heartbeatTicker = c.startClientHeartbeat()
+	c.heartbeatTicker = time.NewTicker(time.Duration(c.heartbeatInterval) * time.Second)
+	c.heartbeatStop = make(chan struct{})
+	go c.runClientHeartbeat(c.heartbeatTicker, c.heartbeatStop)
 	return nil
 }
 
@@ -36,30 +72,61 @@ func (c *Client) StopHeartbeat() error {
 	if c.heartbeatMode == ServerHeartbeat {
 		return fmt.Errorf("client is in server heartbeat mode")
 	}
-	if heartbeatTicker == nil {
+	if !c.stopClientHeartbeat() {
 		return fmt.Errorf("heartbeat not active")
 	}
-	heartbeatTicker.Stop()
-	heartbeatTicker = nil
 	return nil
 }
 
-// startClientHeartbeat starts the client heartbeat.
-// It returns a ticker that can be used to stop the heartbeat.
-func (c *Client) startClientHeartbeat() *time.Ticker {
-	ticker := time.NewTicker(time.Duration(c.heartbeatInterval) * time.Second)
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				id, err := c.Register(*c.service, []Route{})
-				if err != nil {
-					log.Printf("heartbeat failed: %s", err)
-				} else {
-					log.Printf("heartbeat success: %d", id)
+// stopClientHeartbeat stops the client heartbeat and its goroutine, and
+// reports whether it was active.
+func (c *Client) stopClientHeartbeat() bool {
+	c.heartbeatMu.Lock()
+	defer c.heartbeatMu.Unlock()
+	if c.heartbeatTicker == nil {
+		return false
+	}
+	c.heartbeatTicker.Stop()
+	close(c.heartbeatStop)
+	c.heartbeatTicker = nil
+	c.heartbeatStop = nil
+	return true
+}
+
+// runClientHeartbeat sends a heartbeat on every tick until stop or the
+// client is closed. Each heartbeat is skipped if the HeartbeatCheck of the
+// Config fails.
+func (c *Client) runClientHeartbeat(ticker *time.Ticker, stop chan struct{}) {
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+			service := c.Service()
+			if service == nil || c.IsDraining() {
+				continue
+			}
+			if c.State() == Disconnected {
+				c.recordHeartbeat(ErrDisconnected)
+				c.logger.Printf("heartbeat skipped: %s", ErrDisconnected)
+				continue
+			}
+			if c.heartbeatCheck != nil {
+				if err := c.heartbeatCheck(); err != nil {
+					c.recordHeartbeat(err)
+					c.logger.Printf("heartbeat skipped: %s", err)
+					continue
 				}
 			}
+			id, err := c.reregister(*service)
+			c.recordHeartbeat(err)
+			if err != nil {
+				c.logger.Printf("heartbeat failed: %s", err)
+			} else {
+				c.logger.Printf("heartbeat success: %d", id)
+			}
 		}
-	}()
-	return ticker
+	}
 }
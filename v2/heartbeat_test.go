@@ -0,0 +1,60 @@
+package rincon
+
+import "testing"
+
+func TestHeartbeatIsPerClient(t *testing.T) {
+	f := newFakeRincon(t)
+	first := newTestClient(t, f, Config{HeartbeatMode: ClientHeartbeat, HeartbeatInterval: 60})
+	second := newTestClient(t, f, Config{HeartbeatMode: ClientHeartbeat, HeartbeatInterval: 60})
+	if _, err := first.Register(Service{Name: "first", Endpoint: "http://first:8080"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Register(Service{Name: "second", Endpoint: "http://second:8080"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.StopHeartbeat(); err != nil {
+		t.Fatalf("first StopHeartbeat: %s", err)
+	}
+	if err := second.StopHeartbeat(); err != nil {
+		t.Fatalf("second StopHeartbeat: %s", err)
+	}
+	if err := first.StopHeartbeat(); err == nil {
+		t.Fatal("StopHeartbeat of a stopped heartbeat succeeded")
+	}
+}
+
+func TestStopHeartbeatStopsGoroutine(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{HeartbeatMode: ClientHeartbeat, HeartbeatInterval: 60})
+	if _, err := client.Register(Service{Name: "beating", Endpoint: "http://beating:8080"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	stop := client.heartbeatStop
+
+	if err := client.StopHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stop:
+	default:
+		t.Fatal("StopHeartbeat did not stop the heartbeat goroutine")
+	}
+	if err := client.StartHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if client.heartbeatStop == stop {
+		t.Fatal("StartHeartbeat reused the stopped heartbeat")
+	}
+
+	restarted := client.heartbeatStop
+	client.Close()
+	select {
+	case <-restarted:
+	default:
+		t.Fatal("Close did not stop the heartbeat")
+	}
+	if client.heartbeatTicker != nil || client.heartbeatStop != nil {
+		t.Fatal("Close did not clear the heartbeat")
+	}
+}
@@ -0,0 +1,396 @@
+package rincon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bk1031/rincon-go/v2/match"
+)
+
+const (
+	// latencySamples is the number of recent latencies kept per service
+	// to estimate the hedge delay.
+	latencySamples = 128
+	// minLatencySamples is the number of latencies needed before requests
+	// to a service are hedged.
+	minLatencySamples = 20
+	// retryBudgetBurst is the number of extra requests a budget can hold.
+	retryBudgetBurst = 10
+)
+
+// RequestPolicy opts the requests for a route of a service into hedging
+// and retries. Both only apply to requests with an idempotent method whose
+// body, if any, can be replayed, and every extra request is paid for by
+// the service's retry budget.
+type RequestPolicy struct {
+	// Service is the name of the target service.
+	Service string
+	// Route and Method are the route pattern the request path is matched
+	// against, with the same syntax and precedence as registered routes.
+	Route  string
+	Method string
+	// Hedge sends a second request to another instance if the first has
+	// not answered within the 95th percentile of recent latencies of the
+	// service. The first response to arrive is used.
+	Hedge bool
+	// Retries is the number of times a request is retried on another
+	// instance after a connection failure.
+	Retries int
+}
+
+// requestPolicies holds the compiled RequestPolicies of a client.
+type requestPolicies struct {
+	tables   map[string]*match.Table
+	policies map[string]RequestPolicy
+}
+
+// compileRequestPolicies builds a route table for the policies of each
+// service.
+func compileRequestPolicies(policies []RequestPolicy) (*requestPolicies, error) {
+	compiled := &requestPolicies{
+		tables:   make(map[string]*match.Table),
+		policies: make(map[string]RequestPolicy),
+	}
+	routes := make(map[string][]match.Route)
+	for _, policy := range policies {
+		pattern, err := ParseRoutePattern(policy.Route, policy.Method)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request policy for %s: %w", policy.Service, err)
+		}
+		route := match.Route{Route: pattern.Route(), Method: pattern.Method(), Service: policy.Service}
+		routes[policy.Service] = append(routes[policy.Service], route)
+		compiled.policies[policyKey(route)] = policy
+	}
+	for service, serviceRoutes := range routes {
+		compiled.tables[service] = match.NewTable(serviceRoutes)
+	}
+	return compiled, nil
+}
+
+func policyKey(route match.Route) string {
+	return route.Service + " " + route.Method + " " + route.Route
+}
+
+// requestPolicy returns the policy for a request to the named service, or
+// nil if the request may not be hedged or retried.
+func (c *Client) requestPolicy(name string, req *http.Request) *RequestPolicy {
+	if c.requestPolicies == nil || !isIdempotent(req.Method) {
+		return nil
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return nil
+	}
+	table, ok := c.requestPolicies.tables[name]
+	if !ok {
+		return nil
+	}
+	route, ok := table.Match(req.URL.Path, req.Method)
+	if !ok {
+		return nil
+	}
+	policy := c.requestPolicies.policies[policyKey(route)]
+	return &policy
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// latencies is a ring of the recent response latencies of a service.
+type latencies struct {
+	samples []time.Duration
+	next    int
+}
+
+func (l *latencies) add(d time.Duration) {
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, d)
+		return
+	}
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencySamples
+}
+
+func (l *latencies) p95() (time.Duration, bool) {
+	if len(l.samples) < minLatencySamples {
+		return 0, false
+	}
+	sorted := append([]time.Duration(nil), l.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)*95/100], true
+}
+
+// retryBudget caps the extra requests sent for a service. Every request
+// that has a policy deposits RetryBudget tokens, up to retryBudgetBurst,
+// and every hedge or retry withdraws one. No budget is kept if the
+// RetryBudget is 0.
+type retryBudget struct {
+	tokens float64
+}
+
+// serviceStats holds the latencies and retry budgets of every service.
+type serviceStats struct {
+	mu        sync.Mutex
+	latencies map[string]*latencies
+	budgets   map[string]*retryBudget
+}
+
+func (c *Client) recordLatency(name string, d time.Duration) {
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+	if c.stats.latencies == nil {
+		c.stats.latencies = make(map[string]*latencies)
+	}
+	l, ok := c.stats.latencies[name]
+	if !ok {
+		l = &latencies{}
+		c.stats.latencies[name] = l
+	}
+	l.add(d)
+}
+
+// hedgeDelay returns the 95th percentile of the recent latencies of the
+// named service. It returns false until enough latencies are recorded.
+func (c *Client) hedgeDelay(name string) (time.Duration, bool) {
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+	l, ok := c.stats.latencies[name]
+	if !ok {
+		return 0, false
+	}
+	return l.p95()
+}
+
+// depositBudget adds the share of an extra request that a request with a
+// policy earns to the budget of the named service.
+func (c *Client) depositBudget(name string) {
+	if c.retryBudget == 0 {
+		return
+	}
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+	if c.stats.budgets == nil {
+		c.stats.budgets = make(map[string]*retryBudget)
+	}
+	b, ok := c.stats.budgets[name]
+	if !ok {
+		b = &retryBudget{tokens: retryBudgetBurst}
+		c.stats.budgets[name] = b
+	}
+	b.tokens += c.retryBudget
+	if b.tokens > retryBudgetBurst {
+		b.tokens = retryBudgetBurst
+	}
+}
+
+// withdrawBudget takes one extra request from the budget of the named
+// service, and returns false if the budget is spent. It always returns
+// true if the budget is disabled.
+func (c *Client) withdrawBudget(name string) bool {
+	if c.retryBudget == 0 {
+		return true
+	}
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+	b, ok := c.stats.budgets[name]
+	if !ok || b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// attemptResult is the outcome of one request to one instance.
+type attemptResult struct {
+	resp    *http.Response
+	service *Service
+	err     error
+	index   int
+}
+
+// roundTrip sends a request whose URL path is relative to the named
+// service to an instance picked from instances. If a RequestPolicy applies
+// to the request, it is hedged and retried on other instances as allowed
+// by the policy and the retry budget. It returns the first response and
+// the instance that sent it.
+func (c *Client) roundTrip(base http.RoundTripper, req *http.Request, name string, instances []Service, key string) (*http.Response, *Service, error) {
+	first, err := c.pickInstance(instances, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	policy := c.requestPolicy(name, req)
+	if policy == nil {
+		resp, err := c.attempt(req.Context(), base, req, name, *first)
+		return resp, first, err
+	}
+	c.depositBudget(name)
+
+	results := make(chan attemptResult)
+	tried := []Service{*first}
+	cancels := make([]context.CancelFunc, 0, 2)
+	launch := func(service *Service) {
+		ctx, cancel := context.WithCancel(req.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := c.attempt(ctx, base, req, name, *service)
+			results <- attemptResult{resp: resp, service: service, err: err, index: index}
+		}()
+	}
+	launch(first)
+	pending := 1
+
+	var hedge <-chan time.Time
+	if policy.Hedge {
+		if delay, ok := c.hedgeDelay(name); ok {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			hedge = timer.C
+		}
+	}
+	retries := 0
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-hedge:
+			hedge = nil
+			if alternate := c.alternate(instances, tried, key); alternate != nil && c.withdrawBudget(name) {
+				tried = append(tried, *alternate)
+				launch(alternate)
+				pending++
+			}
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				for i, cancel := range cancels {
+					if i != result.index {
+						cancel()
+					}
+				}
+				go discardAttempts(results, pending)
+				result.resp.Body = &cancelOnClose{ReadCloser: result.resp.Body, cancel: cancels[result.index]}
+				return result.resp, result.service, nil
+			}
+			cancels[result.index]()
+			lastErr = result.err
+			if retries >= policy.Retries || req.Context().Err() != nil {
+				continue
+			}
+			if alternate := c.alternate(instances, tried, key); alternate != nil && c.withdrawBudget(name) {
+				retries++
+				tried = append(tried, *alternate)
+				launch(alternate)
+				pending++
+			}
+		}
+	}
+	return nil, nil, lastErr
+}
+
+// alternate picks an instance that has not been tried yet, or returns nil
+// if there is none.
+func (c *Client) alternate(instances []Service, tried []Service, key string) *Service {
+	remaining := make([]Service, 0, len(instances))
+	for _, instance := range instances {
+		seen := false
+		for _, t := range tried {
+			if t.ID == instance.ID {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			remaining = append(remaining, instance)
+		}
+	}
+	if len(remaining) == 0 {
+		return nil
+	}
+	service, err := c.pickInstance(remaining, key)
+	if err != nil {
+		return nil
+	}
+	return service
+}
+
+// attempt sends the request to the instance, records its outcome with the
+// instance's circuit breaker and, if it succeeded, its latency.
+func (c *Client) attempt(ctx context.Context, base http.RoundTripper, req *http.Request, name string, service Service) (*http.Response, error) {
+	out, err := instanceRequest(ctx, req, service)
+	if err != nil {
+		return nil, err
+	}
+	span, out := c.startSpan(out, out.Method+" "+name, map[string]string{
+		"service":  name,
+		"instance": strconv.Itoa(service.ID),
+		"endpoint": service.Endpoint,
+	})
+	start := time.Now()
+	resp, err := base.RoundTrip(out)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	c.endSpan(span, status, err)
+	c.recordResult(service, status, err)
+	if err == nil {
+		c.recordLatency(name, time.Since(start))
+	}
+	return resp, err
+}
+
+// instanceRequest returns a copy of the request addressed to the endpoint
+// of the instance. The body is replayed with GetBody when it is available.
+func instanceRequest(ctx context.Context, req *http.Request, service Service) (*http.Request, error) {
+	target, err := parseEndpoint(service)
+	if err != nil {
+		return nil, err
+	}
+	out := req.Clone(ctx)
+	if req.GetBody != nil {
+		if out.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	out.URL.Scheme = target.Scheme
+	out.URL.Host = target.Host
+	out.URL.Path = strings.TrimSuffix(target.Path, "/") + req.URL.Path
+	out.URL.RawPath = ""
+	out.Host = ""
+	return out, nil
+}
+
+// discardAttempts closes the responses of the attempts that lost a hedge,
+// which have already been canceled.
+func discardAttempts(results <-chan attemptResult, pending int) {
+	for ; pending > 0; pending-- {
+		result := <-results
+		if result.resp != nil {
+			result.resp.Body.Close()
+		}
+	}
+}
+
+// cancelOnClose cancels the context of a winning attempt once its body is
+// closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
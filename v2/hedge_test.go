@@ -0,0 +1,139 @@
+package rincon
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newBackend returns an instance of the "orders" service that responds
+// with its name after the given delay.
+func newBackend(t *testing.T, f *fakeRincon, name string, delay time.Duration) (Service, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte(name))
+	}))
+	t.Cleanup(backend.Close)
+	return f.add(Service{Name: "orders", Version: "1.0.0", Endpoint: backend.URL}), &requests
+}
+
+func getBody(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestRetryOnConnectionFailure(t *testing.T) {
+	f := newFakeRincon(t)
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	f.add(Service{Name: "orders", Version: "1.0.0", Endpoint: dead.URL})
+	newBackend(t, f, "live", 0)
+	client := newTestClient(t, f, Config{
+		RequestPolicies: []RequestPolicy{{Service: "orders", Route: "/**", Method: "GET", Retries: 1}},
+	})
+	httpClient := &http.Client{Transport: NewTransport(client)}
+
+	// The balancer alternates between the instances, so half of these
+	// requests are sent to the dead instance first.
+	for i := 0; i < 4; i++ {
+		if body := getBody(t, httpClient, "rincon://orders/items"); body != "live" {
+			t.Fatalf("request %d: got %q, want the live instance", i, body)
+		}
+	}
+	// POST is not idempotent, so it is not retried.
+	failed := 0
+	for i := 0; i < 2; i++ {
+		resp, err := httpClient.Post("rincon://orders/items", "text/plain", strings.NewReader("x"))
+		if err != nil {
+			failed++
+			continue
+		}
+		resp.Body.Close()
+	}
+	if failed != 1 {
+		t.Fatalf("%d of 2 POST requests failed, want the one sent to the dead instance", failed)
+	}
+}
+
+func TestHedgeSlowInstance(t *testing.T) {
+	f := newFakeRincon(t)
+	newBackend(t, f, "slow", 2*time.Second)
+	newBackend(t, f, "fast", 0)
+	client := newTestClient(t, f, Config{
+		RequestPolicies: []RequestPolicy{{Service: "orders", Route: "/**", Method: "GET", Hedge: true}},
+	})
+	for i := 0; i < minLatencySamples; i++ {
+		client.recordLatency("orders", time.Millisecond)
+	}
+	httpClient := &http.Client{Transport: NewTransport(client)}
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		if body := getBody(t, httpClient, "rincon://orders/"); body != "fast" {
+			t.Fatalf("request %d: got %q, want the fast instance", i, body)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("request %d took %s, want it hedged", i, elapsed)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	client.depositBudget("orders")
+	for i := 0; i < retryBudgetBurst; i++ {
+		if !client.withdrawBudget("orders") {
+			t.Fatalf("withdrawal %d refused within the burst", i)
+		}
+	}
+	if client.withdrawBudget("orders") {
+		t.Fatal("withdrawal allowed from a spent budget")
+	}
+	// Each request earns a tenth of an extra request by default. Eleven
+	// deposits avoid relying on ten tenths adding up to exactly one.
+	for i := 0; i < 11; i++ {
+		client.depositBudget("orders")
+	}
+	if !client.withdrawBudget("orders") || client.withdrawBudget("orders") {
+		t.Fatal("want exactly one withdrawal after eleven deposits")
+	}
+	if client.withdrawBudget("users") {
+		t.Fatal("withdrawal allowed from a service without a budget")
+	}
+}
+
+func TestRetryBudgetDisabled(t *testing.T) {
+	f := newFakeRincon(t)
+	disabled := 0.0
+	client := newTestClient(t, f, Config{RetryBudget: &disabled})
+	for i := 0; i < 2*retryBudgetBurst; i++ {
+		if !client.withdrawBudget("orders") {
+			t.Fatalf("withdrawal %d refused with the budget disabled", i)
+		}
+	}
+
+	negative := -1.0
+	var configErr *ConfigError
+	if err := (Config{BaseURL: f.URL, RetryBudget: &negative}).Validate(); !errors.As(err, &configErr) || configErr.Field != "RetryBudget" {
+		t.Fatalf("Validate() = %v, want an error for RetryBudget", err)
+	}
+}
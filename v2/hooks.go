@@ -0,0 +1,177 @@
+package rincon
+
+import (
+	"sync"
+	"time"
+)
+
+// maxQueuedHooks is the number of hook calls that may wait to run. Calls
+// for events beyond it are dropped, so that a hook that blocks cannot make
+// the queue grow without bound.
+const maxQueuedHooks = 1000
+
+// hooks holds the lifecycle hooks registered on a Client, and the queue of
+// hook calls waiting to run. The calls run one at a time on a goroutine
+// that is started when the queue is not empty, so that the hooks of a
+// client run in the order of their events. Hooks should return quickly:
+// once maxQueuedHooks calls are waiting, further calls are dropped and
+// logged with the number dropped so far.
+type hooks struct {
+	mu                        sync.Mutex
+	onRegistered              []func(service Service)
+	onDeregistered            []func(service Service)
+	onHeartbeat               []func(success bool, err error)
+	onRinconUnreachable       []func(err error)
+	onRinconRecovered         []func(downtime time.Duration)
+	onRouteRegistrationFailed []func(route Route, err error)
+
+	queue   []func()
+	running bool
+	dropped int
+}
+
+// OnRegistered adds a hook called when the client registers a new service
+// instance. It is not called when a heartbeat re-registers the same
+// instance.
+func (c *Client) OnRegistered(fn func(service Service)) {
+	c.hooks.mu.Lock()
+	c.hooks.onRegistered = append(c.hooks.onRegistered, fn)
+	c.hooks.mu.Unlock()
+}
+
+// OnDeregistered adds a hook called when the client deregisters its
+// service instance.
+func (c *Client) OnDeregistered(fn func(service Service)) {
+	c.hooks.mu.Lock()
+	c.hooks.onDeregistered = append(c.hooks.onDeregistered, fn)
+	c.hooks.mu.Unlock()
+}
+
+// OnHeartbeat adds a hook called after every heartbeat sent in client mode
+// and every probe received or missed in server mode.
+func (c *Client) OnHeartbeat(fn func(success bool, err error)) {
+	c.hooks.mu.Lock()
+	c.hooks.onHeartbeat = append(c.hooks.onHeartbeat, fn)
+	c.hooks.mu.Unlock()
+}
+
+// OnRinconUnreachable adds a hook called when the client becomes
+// Disconnected, with the error of the last request.
+func (c *Client) OnRinconUnreachable(fn func(err error)) {
+	c.hooks.mu.Lock()
+	c.hooks.onRinconUnreachable = append(c.hooks.onRinconUnreachable, fn)
+	c.hooks.mu.Unlock()
+}
+
+// OnRinconRecovered adds a hook called when the client is Connected again
+// after being Disconnected, with the time it was disconnected.
+func (c *Client) OnRinconRecovered(fn func(downtime time.Duration)) {
+	c.hooks.mu.Lock()
+	c.hooks.onRinconRecovered = append(c.hooks.onRinconRecovered, fn)
+	c.hooks.mu.Unlock()
+}
+
+// OnRouteRegistrationFailed adds a hook called when a route of the
+// client's service cannot be registered.
+func (c *Client) OnRouteRegistrationFailed(fn func(route Route, err error)) {
+	c.hooks.mu.Lock()
+	c.hooks.onRouteRegistrationFailed = append(c.hooks.onRouteRegistrationFailed, fn)
+	c.hooks.mu.Unlock()
+}
+
+// enqueueHook adds a call of the named hook to the queue, and starts the
+// goroutine running the queue if it is not running. The caller must hold
+// the lock.
+func (c *Client) enqueueHook(name string, fn func()) {
+	if len(c.hooks.queue) >= maxQueuedHooks {
+		c.hooks.dropped++
+		c.logger.Printf("hook queue is full, dropped %s hook (%d dropped)", name, c.hooks.dropped)
+		return
+	}
+	c.hooks.queue = append(c.hooks.queue, func() { c.runHook(name, fn) })
+	if !c.hooks.running {
+		c.hooks.running = true
+		go c.runHooks()
+	}
+}
+
+func (c *Client) runHooks() {
+	for {
+		c.hooks.mu.Lock()
+		if len(c.hooks.queue) == 0 {
+			c.hooks.running = false
+			c.hooks.mu.Unlock()
+			return
+		}
+		call := c.hooks.queue[0]
+		c.hooks.queue[0] = nil
+		c.hooks.queue = c.hooks.queue[1:]
+		c.hooks.mu.Unlock()
+		call()
+	}
+}
+
+// runHook calls a hook, recovering from a panic so that it cannot stop the
+// hooks after it.
+func (c *Client) runHook(name string, call func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Printf("%s hook panicked: %v", name, r)
+		}
+	}()
+	call()
+}
+
+func (c *Client) fireRegistered(service Service) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	for _, fn := range c.hooks.onRegistered {
+		fn := fn
+		c.enqueueHook("OnRegistered", func() { fn(service) })
+	}
+}
+
+func (c *Client) fireDeregistered(service Service) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	for _, fn := range c.hooks.onDeregistered {
+		fn := fn
+		c.enqueueHook("OnDeregistered", func() { fn(service) })
+	}
+}
+
+func (c *Client) fireHeartbeat(err error) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	for _, fn := range c.hooks.onHeartbeat {
+		fn := fn
+		c.enqueueHook("OnHeartbeat", func() { fn(err == nil, err) })
+	}
+}
+
+func (c *Client) fireRouteRegistrationFailed(route Route, err error) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	for _, fn := range c.hooks.onRouteRegistrationFailed {
+		fn := fn
+		c.enqueueHook("OnRouteRegistrationFailed", func() { fn(route, err) })
+	}
+}
+
+func (c *Client) fireRinconUnreachable(err error) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	for _, fn := range c.hooks.onRinconUnreachable {
+		fn := fn
+		c.enqueueHook("OnRinconUnreachable", func() { fn(err) })
+	}
+}
+
+func (c *Client) fireRinconRecovered(downtime time.Duration) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	for _, fn := range c.hooks.onRinconRecovered {
+		fn := fn
+		c.enqueueHook("OnRinconRecovered", func() { fn(downtime) })
+	}
+}
@@ -0,0 +1,144 @@
+package rincon
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hookLog records the hook calls of a test in the order they ran.
+type hookLog struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (l *hookLog) add(call string) {
+	l.mu.Lock()
+	l.calls = append(l.calls, call)
+	l.mu.Unlock()
+}
+
+func (l *hookLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.calls...)
+}
+
+func TestHooksRunInOrder(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	var calls hookLog
+	client.OnRegistered(func(service Service) { calls.add("registered 1 " + service.Name) })
+	client.OnRegistered(func(service Service) { calls.add("registered 2 " + service.Name) })
+	client.OnDeregistered(func(service Service) { calls.add("deregistered " + service.Name) })
+	client.OnHeartbeat(func(success bool, err error) {
+		if success {
+			calls.add("heartbeat")
+		} else {
+			calls.add("missed " + err.Error())
+		}
+	})
+
+	if _, err := client.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	client.recordHeartbeat(nil)
+	client.recordHeartbeat(ErrHeartbeatMissed)
+	if err := client.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"registered 1 orders", "registered 2 orders", "heartbeat", "missed " + ErrHeartbeatMissed.Error(), "deregistered orders"}
+	eventually(t, "all hooks ran", func() bool { return len(calls.get()) >= len(want) })
+	got := calls.get()
+	if len(got) != len(want) {
+		t.Fatalf("hooks ran %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("hooks ran %q, want %q", got, want)
+		}
+	}
+}
+
+func TestHookPanicIsIsolated(t *testing.T) {
+	f := newFakeRincon(t)
+	var out logBuffer
+	client := newTestClient(t, f, Config{Logger: log.New(&out, "", 0)})
+	var calls hookLog
+	client.OnRinconUnreachable(func(err error) { panic("boom") })
+	client.OnRinconUnreachable(func(err error) { calls.add("unreachable") })
+	client.OnRinconRecovered(func(time.Duration) { calls.add("recovered") })
+
+	client.fireRinconUnreachable(errors.New("connection refused"))
+	client.fireRinconRecovered(0)
+
+	eventually(t, "the hooks after the panic ran", func() bool { return len(calls.get()) == 2 })
+	if got := calls.get(); got[0] != "unreachable" || got[1] != "recovered" {
+		t.Fatalf("hooks ran %q, want unreachable, recovered", got)
+	}
+	if !strings.Contains(out.String(), "OnRinconUnreachable hook panicked: boom") {
+		t.Fatalf("panic was not logged:\n%s", out.String())
+	}
+}
+
+func TestHookQueueIsBounded(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	var mu sync.Mutex
+	ran := 0
+	client.OnHeartbeat(func(bool, error) {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		mu.Lock()
+		ran++
+		mu.Unlock()
+	})
+
+	client.fireHeartbeat(nil)
+	<-started
+	for i := 0; i < maxQueuedHooks+10; i++ {
+		client.fireHeartbeat(nil)
+	}
+	client.hooks.mu.Lock()
+	queued, dropped := len(client.hooks.queue), client.hooks.dropped
+	client.hooks.mu.Unlock()
+	if queued != maxQueuedHooks || dropped != 10 {
+		t.Fatalf("queued %d, dropped %d, want %d and 10", queued, dropped, maxQueuedHooks)
+	}
+
+	close(release)
+	eventually(t, "the queued hooks ran", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return ran == maxQueuedHooks+1
+	})
+}
+
+// logBuffer is a buffer for log output that the test reads while the
+// hooks may still be writing to it.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,129 @@
+package rincon
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// IdentityPolicy decides what Register does when an instance of the
+// service from a previous run is still registered.
+type IdentityPolicy int32
+
+const (
+	// IdentityNew always registers a new instance.
+	IdentityNew IdentityPolicy = 0
+	// IdentityReuse adopts the ID of the previous instance, so the
+	// service keeps its ID across restarts.
+	IdentityReuse IdentityPolicy = 1
+	// IdentityReplace deregisters the previous instance before
+	// registering a new one.
+	IdentityReplace IdentityPolicy = 2
+)
+
+// instanceState is the content of the client's StateFile.
+type instanceState struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint"`
+}
+
+// previousInstance returns the ID of the instance registered for the
+// service by a previous run, or zero if there is none. If the StateFile
+// records an ID, it is returned as long as an instance with that ID is
+// still registered under the service's Name, even if its Endpoint has
+// changed, since Rincon may have removed it or given its ID to another
+// service in the meantime. Without a StateFile, an instance with the same
+// Endpoint is taken to be the previous one.
+func (c *Client) previousInstance(service Service) int {
+	stateID := 0
+	if c.stateFile != "" {
+		state, err := readInstanceState(c.stateFile)
+		if err != nil {
+			c.logger.Printf("failed to read state file: %s", err)
+		} else if state != nil && state.Name == service.Name {
+			stateID = state.ID
+		}
+	}
+	instances, err := c.GetServicesByName(service.Name)
+	if err != nil {
+		c.logger.Printf("failed to look up previous instance: %s", err)
+		return 0
+	}
+	for _, instance := range instances {
+		if instance.Stale {
+			continue
+		}
+		if stateID != 0 && instance.ID == stateID {
+			return instance.ID
+		}
+		if stateID == 0 && instance.Endpoint == service.Endpoint {
+			return instance.ID
+		}
+	}
+	if stateID != 0 {
+		c.logger.Printf("registration %d of %s from the state file is no longer registered", stateID, service.Name)
+	}
+	return 0
+}
+
+// applyIdentityPolicy prepares a first registration of the service
+// according to the client's IdentityPolicy.
+func (c *Client) applyIdentityPolicy(service *Service) {
+	if c.identityPolicy == IdentityNew || c.IsRegistered() || service.ID != 0 {
+		return
+	}
+	id := c.previousInstance(*service)
+	if id == 0 {
+		return
+	}
+	switch c.identityPolicy {
+	case IdentityReuse:
+		c.logger.Printf("reusing registration %d of %s", id, service.Name)
+		service.ID = id
+	case IdentityReplace:
+		c.logger.Printf("replacing registration %d of %s", id, service.Name)
+		if err := c.DeregisterByID(id); err != nil {
+			c.logger.Printf("failed to deregister previous instance %d: %s", id, err)
+		}
+	}
+}
+
+// saveInstanceState persists the registration to the StateFile.
+func (c *Client) saveInstanceState(service *Service) {
+	if c.stateFile == "" {
+		return
+	}
+	err := writeJSONFile(c.stateFile, instanceState{
+		ID:       service.ID,
+		Name:     service.Name,
+		Endpoint: service.Endpoint,
+	})
+	if err != nil {
+		c.logger.Printf("failed to write state file: %s", err)
+	}
+}
+
+// clearInstanceState removes the StateFile after deregistration.
+func (c *Client) clearInstanceState() {
+	if c.stateFile == "" {
+		return
+	}
+	if err := os.Remove(c.stateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.logger.Printf("failed to remove state file: %s", err)
+	}
+}
+
+func readInstanceState(path string) (*instanceState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	state := new(instanceState)
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
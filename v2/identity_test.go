@@ -0,0 +1,129 @@
+package rincon
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+var identityService = Service{Name: "orders", Endpoint: "http://orders:8080"}
+
+func TestIdentityReuseFromStateFile(t *testing.T) {
+	f := newFakeRincon(t)
+	config := Config{IdentityPolicy: IdentityReuse, StateFile: filepath.Join(t.TempDir(), "state.json")}
+	first, err := newTestClient(t, f, config).Register(identityService, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted client reuses the ID recorded in the state file.
+	second, err := newTestClient(t, f, config).Register(identityService, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Fatalf("registered as %d, want the previous ID %d", second, first)
+	}
+	if instances := f.instances("orders"); len(instances) != 1 {
+		t.Fatalf("got %d instances, want 1", len(instances))
+	}
+}
+
+func TestIdentityReuseFromStateFileAfterEndpointChange(t *testing.T) {
+	f := newFakeRincon(t)
+	config := Config{IdentityPolicy: IdentityReuse, StateFile: filepath.Join(t.TempDir(), "state.json")}
+	first, err := newTestClient(t, f, config).Register(identityService, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another instance already serves the new endpoint, which must not be
+	// taken for the previous one.
+	other := f.add(Service{Name: "orders", Endpoint: "http://orders-2:8080"})
+
+	// The restarted client moved to the other endpoint, and still reuses
+	// the ID recorded in the state file.
+	moved := identityService
+	moved.Endpoint = "http://orders-2:8080"
+	second, err := newTestClient(t, f, config).Register(moved, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Fatalf("registered as %d, want %d from the state file and not %d", second, first, other.ID)
+	}
+	if instances := f.instances("orders"); len(instances) != 2 {
+		t.Fatalf("got %d instances, want the moved one and the other", len(instances))
+	}
+}
+
+func TestIdentityReuseIgnoresStaleStateFile(t *testing.T) {
+	f := newFakeRincon(t)
+	users := f.add(Service{Name: "users", Endpoint: "http://users:8080"})
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	// The state file names an ID that Rincon has since given to another
+	// service.
+	os.WriteFile(stateFile, []byte(`{"id": `+strconv.Itoa(users.ID)+`, "name": "orders", "endpoint": "http://orders:8080"}`), 0600)
+
+	client := newTestClient(t, f, Config{IdentityPolicy: IdentityReuse, StateFile: stateFile})
+	id, err := client.Register(identityService, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == users.ID {
+		t.Fatalf("reused ID %d of the users service", id)
+	}
+	if instances := f.instances("users"); len(instances) != 1 || instances[0].Endpoint != users.Endpoint {
+		t.Fatalf("users instance was overwritten: %+v", instances)
+	}
+}
+
+func TestIdentityReuseByEndpoint(t *testing.T) {
+	f := newFakeRincon(t)
+	other := f.add(Service{Name: "orders", Endpoint: "http://orders-2:8080"})
+	previous := f.add(identityService)
+
+	client := newTestClient(t, f, Config{IdentityPolicy: IdentityReuse})
+	id, err := client.Register(identityService, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != previous.ID {
+		t.Fatalf("registered as %d, want %d with the same endpoint and not %d", id, previous.ID, other.ID)
+	}
+}
+
+func TestIdentityReplace(t *testing.T) {
+	f := newFakeRincon(t)
+	previous := f.add(identityService)
+	client := newTestClient(t, f, Config{IdentityPolicy: IdentityReplace})
+
+	id, err := client.Register(identityService, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.count("DELETE /rincon/services/"+strconv.Itoa(previous.ID)) != 1 {
+		t.Fatal("previous instance was not deregistered")
+	}
+	if instances := f.instances("orders"); len(instances) != 1 || instances[0].ID != id || id == previous.ID {
+		t.Fatalf("instances = %+v, want only the new registration", instances)
+	}
+}
+
+func TestStateFileCleared(t *testing.T) {
+	f := newFakeRincon(t)
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	client := newTestClient(t, f, Config{IdentityPolicy: IdentityReuse, StateFile: stateFile})
+	if _, err := client.Register(identityService, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stateFile); err != nil {
+		t.Fatalf("state file was not written: %s", err)
+	}
+	if err := client.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Fatalf("state file was not removed: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package rincon
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ServiceLimit caps the requests the client sends to a service through a
+// Transport or Call.
+type ServiceLimit struct {
+	// Rate is the number of requests per second allowed by a token
+	// bucket. If it is zero, the rate is not limited.
+	Rate float64
+	// Burst is the size of the token bucket. It defaults to 1.
+	Burst int
+	// MaxConcurrent is the number of requests that may be in flight at
+	// once, counted until the response body is closed. If it is zero, the
+	// concurrency is not limited.
+	MaxConcurrent int
+	// Wait makes requests over the limit wait until they are allowed or
+	// their context is done. Otherwise, they fail immediately. In both
+	// cases the error is a *LimitError.
+	Wait bool
+}
+
+// limiter enforces the ServiceLimit of one service.
+type limiter struct {
+	limit ServiceLimit
+	slots chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(limit ServiceLimit) *limiter {
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+	l := &limiter{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+	if limit.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, limit.MaxConcurrent)
+	}
+	return l
+}
+
+// acquire waits for a token and a concurrency slot, as allowed by the
+// limit and the context. The returned function releases the slot.
+func (l *limiter) acquire(ctx context.Context, service string) (func(), error) {
+	if err := l.take(ctx, service); err != nil {
+		return nil, err
+	}
+	if l.slots == nil {
+		return func() {}, nil
+	}
+	if l.limit.Wait {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, &LimitError{Service: service, Limit: "concurrency", Err: ctx.Err()}
+		}
+	} else {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			return nil, &LimitError{Service: service, Limit: "concurrency"}
+		}
+	}
+	var once sync.Once
+	return func() { once.Do(func() { <-l.slots }) }, nil
+}
+
+// take takes a token from the bucket. When waiting, the token is reserved
+// up front, and the request fails right away if the context's deadline is
+// before the token would be available.
+func (l *limiter) take(ctx context.Context, service string) error {
+	if l.limit.Rate <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.limit.Rate
+	if l.tokens > float64(l.limit.Burst) {
+		l.tokens = float64(l.limit.Burst)
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mu.Unlock()
+		return nil
+	}
+	if !l.limit.Wait {
+		l.mu.Unlock()
+		return &LimitError{Service: service, Limit: "rate"}
+	}
+	delay := time.Duration((1 - l.tokens) / l.limit.Rate * float64(time.Second))
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		l.mu.Unlock()
+		return &LimitError{Service: service, Limit: "rate", Err: context.DeadlineExceeded}
+	}
+	l.tokens--
+	l.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return &LimitError{Service: service, Limit: "rate", Err: ctx.Err()}
+	}
+}
+
+// releaseOnClose releases a concurrency slot once the response body is
+// closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// limitedRoundTrip sends the request through roundTrip once the limit of
+// the named service allows it.
+func (c *Client) limitedRoundTrip(base http.RoundTripper, req *http.Request, name string, instances []Service, key string) (*http.Response, error) {
+	l, ok := c.limiters[name]
+	if !ok {
+		resp, _, err := c.roundTrip(base, req, name, instances, key)
+		return resp, err
+	}
+	release, err := l.acquire(req.Context(), name)
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := c.roundTrip(base, req, name, instances, key)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
@@ -0,0 +1,111 @@
+package rincon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLimiterRate(t *testing.T) {
+	l := newLimiter(ServiceLimit{Rate: 10, Burst: 2})
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := l.acquire(ctx, "orders"); err != nil {
+			t.Fatalf("request %d within the burst: %s", i, err)
+		}
+	}
+	_, err := l.acquire(ctx, "orders")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "rate" || limitErr.Service != "orders" {
+		t.Fatalf("err = %v, want a rate *LimitError", err)
+	}
+	time.Sleep(120 * time.Millisecond)
+	if _, err := l.acquire(ctx, "orders"); err != nil {
+		t.Fatalf("after a token was refilled: %s", err)
+	}
+}
+
+func TestLimiterRateWait(t *testing.T) {
+	l := newLimiter(ServiceLimit{Rate: 20, Wait: true})
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := l.acquire(ctx, "orders"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("3 requests at 20/s took %s, want about 100ms", elapsed)
+	}
+
+	// A deadline before the next token fails right away.
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := l.acquire(short, "orders")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	l := newLimiter(ServiceLimit{MaxConcurrent: 1})
+	ctx := context.Background()
+	release, err := l.acquire(ctx, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = l.acquire(ctx, "orders")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "concurrency" {
+		t.Fatalf("err = %v, want a concurrency *LimitError", err)
+	}
+	release()
+	release()
+	again, err := l.acquire(ctx, "orders")
+	if err != nil {
+		t.Fatalf("after release: %s", err)
+	}
+	again()
+}
+
+func TestLimiterConcurrencyWait(t *testing.T) {
+	l := newLimiter(ServiceLimit{MaxConcurrent: 1, Wait: true})
+	release, _ := l.acquire(context.Background(), "orders")
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release()
+	}()
+	if _, err := l.acquire(context.Background(), "orders"); err != nil {
+		t.Fatalf("waiting for a slot: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "orders"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestTransportReleasesSlotOnClose(t *testing.T) {
+	f := newFakeRincon(t)
+	newBackend(t, f, "orders", 0)
+	client := newTestClient(t, f, Config{
+		ServiceLimits: map[string]ServiceLimit{"orders": {MaxConcurrent: 1}},
+	})
+	httpClient := &http.Client{Transport: NewTransport(client)}
+
+	resp, err := httpClient.Get("rincon://orders/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var limitErr *LimitError
+	if _, err := httpClient.Get("rincon://orders/"); !errors.As(err, &limitErr) {
+		t.Fatalf("err = %v with the body still open, want a *LimitError", err)
+	}
+	resp.Body.Close()
+	if body := getBody(t, httpClient, "rincon://orders/"); body != "orders" {
+		t.Fatalf("got %q after closing the body", body)
+	}
+}
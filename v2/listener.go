@@ -0,0 +1,115 @@
+package rincon
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// RegisterListener registers the client with the given service definition
+// and routes, deriving the service Endpoint from the address of the given
+// listener. If the listener is bound to an unspecified address, the IP of
+// the interface used to reach the Rincon server is advertised instead.
+// The advertised host and scheme can be overridden with the AdvertiseHost
+// and AdvertiseScheme fields of the Config. If the service HealthCheck is
+// a path, it is resolved against the derived Endpoint. If the service
+// Version is empty, it is filled from the build info of the running binary.
+func (c *Client) RegisterListener(ctx context.Context, listener net.Listener, service Service, routes []Route) (int, error) {
+	endpoint, err := c.listenerEndpoint(ctx, listener)
+	if err != nil {
+		return 0, err
+	}
+	service.Endpoint = endpoint
+	if service.Version == "" {
+		service.Version = buildVersion()
+	}
+	if strings.HasPrefix(service.HealthCheck, "/") {
+		service.HealthCheck = endpoint + service.HealthCheck
+	}
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.Register(service, routes)
+}
+
+// listenerEndpoint returns the endpoint URL that other services should use
+// to reach the given listener.
+func (c *Client) listenerEndpoint(ctx context.Context, listener net.Listener) (string, error) {
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		return "", err
+	}
+	if c.advertiseHost != "" {
+		host = c.advertiseHost
+	} else if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		outboundIP, err := c.outboundIP(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to determine outbound ip: %w", err)
+		}
+		host = outboundIP.String()
+	}
+	scheme := c.advertiseScheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port), nil
+}
+
+// outboundIP returns the local IP of the interface used to reach the
+// Rincon server. No packets are sent, since the UDP dial only selects
+// a route.
+func (c *Client) outboundIP(ctx context.Context) (net.IP, error) {
+	port := c.baseURL.Port()
+	if port == "" {
+		port = "80"
+		if c.baseURL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(c.baseURL.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// buildVersion returns the version of the running binary from its build
+// info, or an empty string if the build info is not available.
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	return versionFromBuildInfo(info)
+}
+
+// versionFromBuildInfo returns the version of the main module from the
+// build info, falling back to the VCS revision. It returns an empty string
+// if neither is available.
+func versionFromBuildInfo(info *debug.BuildInfo) string {
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	revision := ""
+	modified := false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified, _ = strconv.ParseBool(setting.Value)
+		}
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if revision != "" && modified {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,119 @@
+package rincon
+
+import (
+	"context"
+	"net"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestRegisterListenerDerivesEndpoint(t *testing.T) {
+	f := newFakeRincon(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{"bound address", Config{}, "http://127.0.0.1:" + port},
+		{"advertise host", Config{AdvertiseHost: "orders.internal"}, "http://orders.internal:" + port},
+		{"advertise scheme", Config{AdvertiseScheme: "https"}, "https://127.0.0.1:" + port},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, f, tt.config)
+			_, err := client.RegisterListener(context.Background(), listener, Service{Name: "orders", HealthCheck: "/health"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			service := client.Service()
+			if service.Endpoint != tt.want {
+				t.Errorf("Endpoint = %q, want %q", service.Endpoint, tt.want)
+			}
+			if service.HealthCheck != tt.want+"/health" {
+				t.Errorf("HealthCheck = %q, want %q", service.HealthCheck, tt.want+"/health")
+			}
+		})
+	}
+}
+
+func TestRegisterListenerUnspecifiedAddress(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	listener, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	endpoint, err := client.listenerEndpoint(context.Background(), listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fake server is on the loopback interface, so that is the
+	// interface used to reach it.
+	if !strings.HasPrefix(endpoint, "http://127.0.0.1:") {
+		t.Fatalf("endpoint = %q, want the outbound loopback address", endpoint)
+	}
+}
+
+func TestRegisterListenerCanceledContext(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.RegisterListener(ctx, listener, Service{Name: "orders"}, nil); err != context.Canceled {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if client.IsRegistered() {
+		t.Fatal("client registered despite the canceled context")
+	}
+}
+
+func TestVersionFromBuildInfo(t *testing.T) {
+	revision := "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name     string
+		version  string
+		settings []debug.BuildSetting
+		want     string
+	}{
+		{"module version", "v1.4.0", []debug.BuildSetting{{Key: "vcs.revision", Value: revision}}, "v1.4.0"},
+		{"devel uses revision", "(devel)", []debug.BuildSetting{{Key: "vcs.revision", Value: revision}}, "0123456789ab"},
+		{"modified revision", "(devel)", []debug.BuildSetting{{Key: "vcs.revision", Value: revision}, {Key: "vcs.modified", Value: "true"}}, "0123456789ab-dirty"},
+		{"unmodified revision", "", []debug.BuildSetting{{Key: "vcs.revision", Value: "abc123"}, {Key: "vcs.modified", Value: "false"}}, "abc123"},
+		{"modified without revision", "(devel)", []debug.BuildSetting{{Key: "vcs.modified", Value: "true"}}, ""},
+		{"nothing", "(devel)", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &debug.BuildInfo{Main: debug.Module{Path: "example.com/orders", Version: tt.version}, Settings: tt.settings}
+			if got := versionFromBuildInfo(info); got != tt.want {
+				t.Fatalf("versionFromBuildInfo() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterKeepsEmptyVersion(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	if _, err := client.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if version := f.instances("orders")[0].Version; version != "" {
+		t.Fatalf("Version = %q, want it left empty by Register", version)
+	}
+}
@@ -0,0 +1,233 @@
+// Package match implements Rincon's route matching locally, so that
+// requests can be routed without calling the /rincon/match endpoint.
+//
+// Routes are slash separated patterns. A "*" segment matches any single
+// segment and a "**" segment matches any number of remaining segments,
+// including none. When several routes match, exact segments take
+// precedence over "*", which takes precedence over "**", comparing
+// segments from left to right. Routes are registered for a comma
+// separated set of methods, or "*" for every method, and a route
+// registered for the request method takes precedence over a route
+// registered for every method at the same pattern.
+package match
+
+import (
+	"strings"
+	"sync"
+)
+
+// Route is a registered route pattern and the service that handles it.
+type Route struct {
+	Route   string
+	Method  string
+	Service string
+}
+
+// Table is a set of routes that requests can be matched against.
+// It is safe for concurrent use.
+type Table struct {
+	mu   sync.RWMutex
+	root *node
+	size int
+}
+
+type node struct {
+	children map[string]*node
+	routes   []Route
+}
+
+// NewTable returns a Table containing the given routes.
+func NewTable(routes []Route) *Table {
+	t := &Table{}
+	t.Replace(routes)
+	return t
+}
+
+// Replace atomically replaces every route in the table.
+func (t *Table) Replace(routes []Route) {
+	root := &node{}
+	for _, route := range routes {
+		n := root
+		for _, segment := range Segments(route.Route) {
+			if n.children == nil {
+				n.children = make(map[string]*node)
+			}
+			child, ok := n.children[segment]
+			if !ok {
+				child = &node{}
+				n.children[segment] = child
+			}
+			n = child
+		}
+		n.routes = append(n.routes, route)
+	}
+	t.mu.Lock()
+	t.root = root
+	t.size = len(routes)
+	t.mu.Unlock()
+}
+
+// Len returns the number of routes in the table.
+func (t *Table) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.size
+}
+
+// Match returns the route that handles the given path and method.
+// It returns false if no route matches.
+func (t *Table) Match(path, method string) (Route, bool) {
+	t.mu.RLock()
+	root := t.root
+	t.mu.RUnlock()
+	if root == nil {
+		return Route{}, false
+	}
+	route := root.match(Segments(path), strings.ToUpper(method))
+	if route == nil {
+		return Route{}, false
+	}
+	return *route, true
+}
+
+// match walks the tree depth first in precedence order, backtracking
+// when a more specific branch has no route for the method.
+func (n *node) match(segments []string, method string) *Route {
+	if len(segments) == 0 {
+		if route := selectMethod(n.routes, method); route != nil {
+			return route
+		}
+		if child, ok := n.children["**"]; ok {
+			return selectMethod(child.routes, method)
+		}
+		return nil
+	}
+	if child, ok := n.children[segments[0]]; ok && segments[0] != "*" && segments[0] != "**" {
+		if route := child.match(segments[1:], method); route != nil {
+			return route
+		}
+	}
+	if child, ok := n.children["*"]; ok {
+		if route := child.match(segments[1:], method); route != nil {
+			return route
+		}
+	}
+	if child, ok := n.children["**"]; ok {
+		return selectMethod(child.routes, method)
+	}
+	return nil
+}
+
+// Result is a route that matches a request, with the request segments
+// captured by its wildcards.
+type Result struct {
+	Route Route
+	// Params are the segments matched by each "*" segment of the route,
+	// in order, followed by the remaining path matched by a "**" segment.
+	Params []string
+}
+
+// Explain returns every route that matches the given path and method, in
+// order of precedence. The first result is the route returned by Match.
+func (t *Table) Explain(path, method string) []Result {
+	t.mu.RLock()
+	root := t.root
+	t.mu.RUnlock()
+	if root == nil {
+		return nil
+	}
+	var results []Result
+	root.collect(Segments(path), strings.ToUpper(method), nil, &results)
+	return results
+}
+
+// collect appends every matching route to results, walking the tree in the
+// same precedence order as match.
+func (n *node) collect(segments []string, method string, params []string, results *[]Result) {
+	if len(segments) == 0 {
+		collectMethod(n.routes, method, params, results)
+		if child, ok := n.children["**"]; ok {
+			collectMethod(child.routes, method, append(params[:len(params):len(params)], ""), results)
+		}
+		return
+	}
+	if child, ok := n.children[segments[0]]; ok && segments[0] != "*" && segments[0] != "**" {
+		child.collect(segments[1:], method, params, results)
+	}
+	if child, ok := n.children["*"]; ok {
+		child.collect(segments[1:], method, append(params[:len(params):len(params)], segments[0]), results)
+	}
+	if child, ok := n.children["**"]; ok {
+		collectMethod(child.routes, method, append(params[:len(params):len(params)], strings.Join(segments, "/")), results)
+	}
+}
+
+// collectMethod appends the routes registered for the method, followed by
+// the routes registered for every method.
+func collectMethod(routes []Route, method string, params []string, results *[]Result) {
+	var everyMethod []Result
+	for _, route := range routes {
+		methods := Methods(route.Method)
+		if methods == nil {
+			everyMethod = append(everyMethod, Result{Route: route, Params: params})
+			continue
+		}
+		for _, m := range methods {
+			if m == method {
+				*results = append(*results, Result{Route: route, Params: params})
+				break
+			}
+		}
+	}
+	*results = append(*results, everyMethod...)
+}
+
+// selectMethod returns the route registered for the method, falling back
+// to a route registered for every method.
+func selectMethod(routes []Route, method string) *Route {
+	var everyMethod *Route
+	for i := range routes {
+		methods := Methods(routes[i].Method)
+		if methods == nil {
+			if everyMethod == nil {
+				everyMethod = &routes[i]
+			}
+			continue
+		}
+		for _, m := range methods {
+			if m == method {
+				return &routes[i]
+			}
+		}
+	}
+	return everyMethod
+}
+
+// Segments splits a route into its path segments, ignoring leading,
+// trailing and repeated slashes.
+func Segments(route string) []string {
+	parts := strings.Split(route, "/")
+	segments := parts[:0]
+	for _, part := range parts {
+		if part != "" {
+			segments = append(segments, part)
+		}
+	}
+	return segments
+}
+
+// Methods returns the upper-cased methods of a comma separated method set.
+// It returns nil if the set contains "*", meaning every method.
+func Methods(method string) []string {
+	var methods []string
+	for _, m := range strings.Split(method, ",") {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m == "*" {
+			return nil
+		}
+		if m != "" {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
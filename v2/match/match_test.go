@@ -0,0 +1,138 @@
+package match
+
+import "testing"
+
+// TestMatch checks Table against the precedence rules documented by
+// Rincon. The same rules are implemented independently by the fake Rincon
+// server of the rincon package, which runs Probes against it.
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []Route
+		path   string
+		method string
+		want   string
+	}{
+		{"exact", []Route{
+			{"/orders", "GET", "orders"},
+		}, "/orders", "GET", "orders"},
+		{"no match", []Route{
+			{"/orders", "GET", "orders"},
+		}, "/users", "GET", ""},
+		{"method not registered", []Route{
+			{"/orders", "GET,POST", "orders"},
+		}, "/orders", "DELETE", ""},
+		{"method is case insensitive", []Route{
+			{"/orders", "get", "orders"},
+		}, "/orders", "Get", "orders"},
+		{"star matches one segment", []Route{
+			{"/orders/*", "*", "orders"},
+		}, "/orders/1", "GET", "orders"},
+		{"star does not match two segments", []Route{
+			{"/orders/*", "*", "orders"},
+		}, "/orders/1/items", "GET", ""},
+		{"star does not match none", []Route{
+			{"/orders/*", "*", "orders"},
+		}, "/orders", "GET", ""},
+		{"double star matches none", []Route{
+			{"/orders/**", "*", "orders"},
+		}, "/orders", "GET", "orders"},
+		{"double star matches many", []Route{
+			{"/orders/**", "*", "orders"},
+		}, "/orders/1/items/2", "GET", "orders"},
+		{"exact before star", []Route{
+			{"/orders/*", "*", "wildcard"},
+			{"/orders/new", "*", "exact"},
+		}, "/orders/new", "GET", "exact"},
+		{"star before double star", []Route{
+			{"/orders/**", "*", "any"},
+			{"/orders/*", "*", "one"},
+		}, "/orders/1", "GET", "one"},
+		{"leftmost segment decides", []Route{
+			{"/*/items", "*", "items"},
+			{"/orders/**", "*", "orders"},
+		}, "/orders/items", "GET", "orders"},
+		{"backtracks from exact", []Route{
+			{"/orders/new/confirm", "*", "confirm"},
+			{"/orders/*/items", "*", "items"},
+		}, "/orders/new/items", "GET", "items"},
+		{"backtracks on method", []Route{
+			{"/orders/new", "POST", "create"},
+			{"/orders/*", "GET", "read"},
+		}, "/orders/new", "GET", "read"},
+		{"method before every method", []Route{
+			{"/orders", "*", "every"},
+			{"/orders", "GET", "get"},
+		}, "/orders", "GET", "get"},
+		{"exact every method before wildcard method", []Route{
+			{"/orders/*", "GET", "wildcard"},
+			{"/orders/new", "*", "exact"},
+		}, "/orders/new", "GET", "exact"},
+		{"first registered wins", []Route{
+			{"/orders", "GET", "first"},
+			{"/orders/", "GET", "second"},
+		}, "/orders", "GET", "first"},
+		{"slashes are collapsed", []Route{
+			{"/orders/*", "*", "orders"},
+		}, "//orders///1/", "GET", "orders"},
+		{"root double star", []Route{
+			{"/**", "*", "fallback"},
+			{"/orders", "*", "orders"},
+		}, "/", "GET", "fallback"},
+		{"literal star in path", []Route{
+			{"/orders/*", "*", "wildcard"},
+		}, "/orders/*", "GET", "wildcard"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := NewTable(tt.routes)
+
+			got, ok := table.Match(tt.path, tt.method)
+			if ok != (tt.want != "") || got.Service != tt.want {
+				t.Fatalf("matched %q, want %q", got.Service, tt.want)
+			}
+			if results := table.Explain(tt.path, tt.method); ok && (len(results) == 0 || results[0].Route != got) {
+				t.Fatalf("Explain()[0] = %+v, want %+v", results, got)
+			}
+		})
+	}
+}
+
+func TestProbesCoverWildcards(t *testing.T) {
+	probes := Probes([]Route{{"/orders/*/items/**", "GET", "items"}})
+	want := []Probe{
+		{"/orders/probe/items", "GET"},
+		{"/orders/probe/items/probe", "GET"},
+		{"/orders/probe/items/probe/xxxx", "GET"},
+	}
+	if len(probes) != len(want) {
+		t.Fatalf("Probes = %+v, want %+v", probes, want)
+	}
+	for i := range want {
+		if probes[i] != want[i] {
+			t.Fatalf("Probes = %+v, want %+v", probes, want)
+		}
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tests := map[string][]string{
+		"GET":         {"GET"},
+		"get, post":   {"GET", "POST"},
+		"GET,*":       nil,
+		"*":           nil,
+		" ,DELETE, ,": {"DELETE"},
+	}
+	for in, want := range tests {
+		got := Methods(in)
+		if len(got) != len(want) || (got == nil) != (want == nil) {
+			t.Errorf("Methods(%q) = %q, want %q", in, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Methods(%q) = %q, want %q", in, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package match
+
+import "strings"
+
+// Probe is a request path and method used to compare local matching
+// against the /rincon/match endpoint of a Rincon server.
+type Probe struct {
+	Path   string
+	Method string
+}
+
+// probeMethods are the methods tried for routes registered for every method.
+var probeMethods = []string{"GET", "POST", "DELETE"}
+
+// Probes returns requests that exercise every route in the given set,
+// including its wildcard segments and methods. A server and a Table built
+// from the same routes should agree on the match for every probe.
+func Probes(routes []Route) []Probe {
+	seen := make(map[Probe]bool)
+	var probes []Probe
+	add := func(path, method string) {
+		probe := Probe{Path: path, Method: method}
+		if !seen[probe] {
+			seen[probe] = true
+			probes = append(probes, probe)
+		}
+	}
+	for _, route := range routes {
+		methods := Methods(route.Method)
+		if methods == nil {
+			methods = probeMethods
+		}
+		for _, path := range probePaths(Segments(route.Route)) {
+			for _, method := range methods {
+				add(path, method)
+			}
+		}
+	}
+	return probes
+}
+
+// probePaths returns concrete paths matched by the given pattern segments.
+// A "**" segment is expanded to zero, one and two segments.
+func probePaths(segments []string) []string {
+	var concrete []string
+	for i, segment := range segments {
+		switch segment {
+		case "*":
+			concrete = append(concrete, "probe")
+		case "**":
+			base := "/" + strings.Join(concrete, "/")
+			if len(concrete) == 0 {
+				base = ""
+			}
+			return []string{
+				nonEmpty(base),
+				base + "/probe",
+				base + "/probe/" + strings.Repeat("x", i+1),
+			}
+		default:
+			concrete = append(concrete, segment)
+		}
+	}
+	return []string{"/" + strings.Join(concrete, "/")}
+}
+
+func nonEmpty(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
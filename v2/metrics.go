@@ -0,0 +1,269 @@
+package rincon
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrHeartbeatMissed is passed to Instrumentation.Heartbeat when no Rincon
+// probe arrived within the HeartbeatMissedThreshold in server heartbeat
+// mode.
+var ErrHeartbeatMissed = errors.New("heartbeat missed")
+
+// Instrumentation receives events from a Client, for example to export
+// metrics. Its methods are called synchronously and must not block.
+type Instrumentation interface {
+	// RinconRequest is called after every request to the Rincon API.
+	// The endpoint is the path with names and IDs replaced by
+	// placeholders, and the status is zero if the request failed.
+	RinconRequest(endpoint, method string, status int, duration time.Duration)
+	// Heartbeat is called after every heartbeat sent in client mode and
+	// every probe received in server mode, with the error if it failed.
+	Heartbeat(err error)
+	// SnapshotLookup is called when the instances of a service are looked
+	// up for a request, with hit set if they came from the local Snapshot
+	// rather than from Rincon.
+	SnapshotLookup(service string, hit bool)
+	// BalancerPick is called after an instance of a service is picked,
+	// with the error if none could be, in which case instance is nil.
+	BalancerPick(service string, instance *Service, err error)
+	// BreakerStateChange is called when the circuit breaker of an
+	// instance changes state.
+	BreakerStateChange(service Service, from, to BreakerState)
+}
+
+type nopInstrumentation struct{}
+
+func (nopInstrumentation) RinconRequest(string, string, int, time.Duration)       {}
+func (nopInstrumentation) Heartbeat(error)                                        {}
+func (nopInstrumentation) SnapshotLookup(string, bool)                            {}
+func (nopInstrumentation) BalancerPick(string, *Service, error)                   {}
+func (nopInstrumentation) BreakerStateChange(Service, BreakerState, BreakerState) {}
+
+// endpointLabel replaces the service names and IDs in a Rincon API path
+// with placeholders, so that metrics have a bounded number of endpoints.
+func endpointLabel(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) >= 3 && segments[0] == "rincon" && segments[1] == "services" {
+		segments[2] = "{name}"
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// durationBuckets are the upper bounds in seconds of the histogram of
+// Rincon request durations.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(durationBuckets))
+	}
+	for i, bound := range durationBuckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Metrics is an Instrumentation that collects the client's events and
+// serves them in the Prometheus text exposition format. Set it as the
+// Instrumentation of the Config and serve it at /metrics:
+//
+//	metrics := rincon.NewMetrics()
+//	client, err := rincon.NewClient(rincon.Config{..., Instrumentation: metrics})
+//	http.Handle("/metrics", metrics)
+type Metrics struct {
+	mu                   sync.Mutex
+	requests             map[[3]string]uint64
+	durations            map[[2]string]*histogram
+	heartbeats           map[string]uint64
+	lastHeartbeatSuccess time.Time
+	heartbeatFailures    int
+	snapshotLookups      map[[2]string]uint64
+	picks                map[[2]string]uint64
+	breakers             map[[2]string]BreakerState
+}
+
+// NewMetrics returns an empty Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:        make(map[[3]string]uint64),
+		durations:       make(map[[2]string]*histogram),
+		heartbeats:      make(map[string]uint64),
+		snapshotLookups: make(map[[2]string]uint64),
+		picks:           make(map[[2]string]uint64),
+		breakers:        make(map[[2]string]BreakerState),
+	}
+}
+
+// RinconRequest implements Instrumentation.
+func (m *Metrics) RinconRequest(endpoint, method string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code := "error"
+	if status != 0 {
+		code = strconv.Itoa(status)
+	}
+	m.requests[[3]string{endpoint, method, code}]++
+	h, ok := m.durations[[2]string{endpoint, method}]
+	if !ok {
+		h = &histogram{}
+		m.durations[[2]string{endpoint, method}] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// Heartbeat implements Instrumentation.
+func (m *Metrics) Heartbeat(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.heartbeats["failure"]++
+		m.heartbeatFailures++
+		return
+	}
+	m.heartbeats["success"]++
+	m.heartbeatFailures = 0
+	m.lastHeartbeatSuccess = time.Now()
+}
+
+// SnapshotLookup implements Instrumentation.
+func (m *Metrics) SnapshotLookup(service string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.mu.Lock()
+	m.snapshotLookups[[2]string{service, result}]++
+	m.mu.Unlock()
+}
+
+// BalancerPick implements Instrumentation. Picks are counted by version
+// rather than instance, so that the number of series does not grow as
+// instances are replaced.
+func (m *Metrics) BalancerPick(service string, instance *Service, err error) {
+	version := "none"
+	if err == nil && instance != nil {
+		version = instance.Version
+	}
+	m.mu.Lock()
+	m.picks[[2]string{service, version}]++
+	m.mu.Unlock()
+}
+
+// BreakerStateChange implements Instrumentation.
+func (m *Metrics) BreakerStateChange(service Service, from, to BreakerState) {
+	m.mu.Lock()
+	m.breakers[[2]string{service.Name, strconv.Itoa(service.ID)}] = to
+	m.mu.Unlock()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := new(strings.Builder)
+
+	writeHeader(b, "rincon_requests_total", "counter", "Requests to the Rincon API by endpoint, method and status.")
+	for _, key := range sortedKeys3(m.requests) {
+		fmt.Fprintf(b, "rincon_requests_total{endpoint=\"%s\",method=\"%s\",status=\"%s\"} %d\n", labelValue(key[0]), labelValue(key[1]), labelValue(key[2]), m.requests[key])
+	}
+
+	writeHeader(b, "rincon_request_duration_seconds", "histogram", "Duration of requests to the Rincon API by endpoint and method.")
+	for _, key := range sortedKeys2(m.durations) {
+		h := m.durations[key]
+		labels := fmt.Sprintf("endpoint=\"%s\",method=\"%s\"", labelValue(key[0]), labelValue(key[1]))
+		for i, bound := range durationBuckets {
+			fmt.Fprintf(b, "rincon_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(b, "rincon_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(b, "rincon_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(b, "rincon_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	writeHeader(b, "rincon_heartbeats_total", "counter", "Heartbeats by result.")
+	for _, result := range []string{"success", "failure"} {
+		fmt.Fprintf(b, "rincon_heartbeats_total{result=\"%s\"} %d\n", result, m.heartbeats[result])
+	}
+	writeHeader(b, "rincon_heartbeat_last_success_timestamp_seconds", "gauge", "Unix time of the last successful heartbeat.")
+	last := 0.0
+	if !m.lastHeartbeatSuccess.IsZero() {
+		last = float64(m.lastHeartbeatSuccess.UnixNano()) / 1e9
+	}
+	fmt.Fprintf(b, "rincon_heartbeat_last_success_timestamp_seconds %s\n", strconv.FormatFloat(last, 'f', 3, 64))
+	writeHeader(b, "rincon_heartbeat_consecutive_failures", "gauge", "Heartbeats failed since the last success.")
+	fmt.Fprintf(b, "rincon_heartbeat_consecutive_failures %d\n", m.heartbeatFailures)
+
+	writeHeader(b, "rincon_snapshot_lookups_total", "counter", "Instance lookups by service and whether they were served from the snapshot.")
+	for _, key := range sortedKeys2(m.snapshotLookups) {
+		fmt.Fprintf(b, "rincon_snapshot_lookups_total{service=\"%s\",result=\"%s\"} %d\n", labelValue(key[0]), labelValue(key[1]), m.snapshotLookups[key])
+	}
+
+	writeHeader(b, "rincon_balancer_picks_total", "counter", "Instances picked by the balancer by service and version.")
+	for _, key := range sortedKeys2(m.picks) {
+		fmt.Fprintf(b, "rincon_balancer_picks_total{service=\"%s\",version=\"%s\"} %d\n", labelValue(key[0]), labelValue(key[1]), m.picks[key])
+	}
+
+	writeHeader(b, "rincon_breaker_state", "gauge", "Circuit breaker state by instance: 0 closed, 1 open, 2 half-open.")
+	for _, key := range sortedKeys2(m.breakers) {
+		fmt.Fprintf(b, "rincon_breaker_state{service=\"%s\",instance=\"%s\"} %d\n", labelValue(key[0]), labelValue(key[1]), m.breakers[key])
+	}
+
+	w.Write([]byte(b.String()))
+}
+
+// labelValue escapes a label value for the text exposition format.
+func labelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sortedKeys2[V any](m map[[2]string]V) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
+
+func sortedKeys3(m map[[3]string]uint64) [][3]string {
+	keys := make([][3]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		for k := 0; k < 3; k++ {
+			if keys[i][k] != keys[j][k] {
+				return keys[i][k] < keys[j][k]
+			}
+		}
+		return false
+	})
+	return keys
+}
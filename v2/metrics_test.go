@@ -0,0 +1,99 @@
+package rincon
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	return rec.Body.String()
+}
+
+func expectLines(t *testing.T, output string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("metrics are missing %q:\n%s", line, output)
+		}
+	}
+}
+
+func TestEndpointLabel(t *testing.T) {
+	tests := map[string]string{
+		"/rincon/ping":                   "/rincon/ping",
+		"/rincon/services":               "/rincon/services",
+		"/rincon/services/orders":        "/rincon/services/{name}",
+		"/rincon/services/17":            "/rincon/services/{name}",
+		"/rincon/services/orders/routes": "/rincon/services/{name}/routes",
+	}
+	for path, want := range tests {
+		if got := endpointLabel(path); got != want {
+			t.Errorf("endpointLabel(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.RinconRequest("/rincon/ping", "GET", 200, 20*time.Millisecond)
+	m.RinconRequest("/rincon/ping", "GET", 0, time.Second)
+	m.Heartbeat(nil)
+	m.Heartbeat(errors.New("refused"))
+	m.Heartbeat(errors.New("refused"))
+	m.SnapshotLookup("orders", true)
+	m.SnapshotLookup("orders", false)
+	m.BalancerPick("orders", &Service{ID: 7, Version: "1.2.0"}, nil)
+	m.BalancerPick("orders", &Service{ID: 8, Version: "1.2.0"}, nil)
+	m.BalancerPick("orders", nil, ErrCircuitOpen)
+	m.BreakerStateChange(Service{ID: 7, Name: "orders"}, BreakerClosed, BreakerOpen)
+	m.SnapshotLookup(`we"ird`, true)
+
+	expectLines(t, scrape(t, m),
+		"# TYPE rincon_requests_total counter",
+		`rincon_requests_total{endpoint="/rincon/ping",method="GET",status="200"} 1`,
+		`rincon_requests_total{endpoint="/rincon/ping",method="GET",status="error"} 1`,
+		`rincon_request_duration_seconds_bucket{endpoint="/rincon/ping",method="GET",le="0.025"} 1`,
+		`rincon_request_duration_seconds_bucket{endpoint="/rincon/ping",method="GET",le="+Inf"} 2`,
+		`rincon_request_duration_seconds_count{endpoint="/rincon/ping",method="GET"} 2`,
+		`rincon_heartbeats_total{result="success"} 1`,
+		`rincon_heartbeats_total{result="failure"} 2`,
+		`rincon_heartbeat_consecutive_failures 2`,
+		`rincon_snapshot_lookups_total{service="orders",result="hit"} 1`,
+		`rincon_snapshot_lookups_total{service="orders",result="miss"} 1`,
+		`rincon_snapshot_lookups_total{service="we\"ird",result="hit"} 1`,
+		`rincon_balancer_picks_total{service="orders",version="1.2.0"} 2`,
+		`rincon_balancer_picks_total{service="orders",version="none"} 1`,
+		`rincon_breaker_state{service="orders",instance="7"} 1`,
+	)
+}
+
+func TestClientInstrumentation(t *testing.T) {
+	f := newFakeRincon(t)
+	newBackend(t, f, "orders", 0)
+	m := NewMetrics()
+	client := newTestClient(t, f, Config{Instrumentation: m})
+	httpClient := &http.Client{Transport: NewTransport(client)}
+	getBody(t, httpClient, "rincon://orders/")
+	if _, err := client.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	getBody(t, httpClient, "rincon://orders/")
+
+	expectLines(t, scrape(t, m),
+		`rincon_requests_total{endpoint="/rincon/ping",method="GET",status="200"} 1`,
+		`rincon_requests_total{endpoint="/rincon/services/{name}",method="GET",status="200"} 2`,
+		`rincon_snapshot_lookups_total{service="orders",result="hit"} 1`,
+		`rincon_snapshot_lookups_total{service="orders",result="miss"} 1`,
+		`rincon_balancer_picks_total{service="orders",version="1.0.0"} 2`,
+	)
+}
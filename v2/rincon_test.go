@@ -0,0 +1,350 @@
+package rincon
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bk1031/rincon-go/v2/match"
+)
+
+// fakeRincon is an in-memory Rincon server for tests.
+type fakeRincon struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	services map[int]Service
+	routes   []Route
+	nextID   int
+	requests map[string]int
+	headers  map[string]http.Header
+
+	// down makes the server drop every connection, as if it were
+	// unreachable, and fail makes it respond with 500.
+	down atomic.Bool
+	fail atomic.Bool
+}
+
+func newFakeRincon(t *testing.T) *fakeRincon {
+	t.Helper()
+	f := &fakeRincon{
+		services: make(map[int]Service),
+		requests: make(map[string]int),
+		headers:  make(map[string]http.Header),
+		nextID:   2,
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	f.services[1] = Service{
+		ID:          1,
+		Name:        "rincon",
+		Version:     "2.0.0",
+		Endpoint:    f.URL,
+		HealthCheck: f.URL + "/rincon/ping",
+	}
+	return f
+}
+
+// newTestClient returns a client of the fake server. Its log output is
+// discarded, since background loops may log after the test has ended.
+func newTestClient(t *testing.T, f *fakeRincon, config Config) *Client {
+	t.Helper()
+	config.BaseURL = f.URL
+	if config.Logger == nil {
+		config.Logger = log.New(io.Discard, "", 0)
+	}
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient: %s", err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+// count returns the number of requests received for "METHOD /path".
+func (f *fakeRincon) count(request string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[request]
+}
+
+// header returns the headers of the last request for "METHOD /path".
+func (f *fakeRincon) header(request string) http.Header {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.headers[request]
+}
+
+func (f *fakeRincon) instances(name string) []Service {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.instancesLocked(name)
+}
+
+func (f *fakeRincon) instancesLocked(name string) []Service {
+	instances := make([]Service, 0)
+	for id := 1; id < f.nextID; id++ {
+		if service, ok := f.services[id]; ok && service.Name == name {
+			instances = append(instances, service)
+		}
+	}
+	return instances
+}
+
+// add registers an instance directly, as another client would.
+func (f *fakeRincon) add(service Service) Service {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	service.ID = f.nextID
+	f.nextID++
+	f.services[service.ID] = service
+	return service
+}
+
+// drop removes an instance, as Rincon does when it misses its heartbeats.
+func (f *fakeRincon) drop(id int) {
+	f.mu.Lock()
+	delete(f.services, id)
+	f.mu.Unlock()
+}
+
+func (f *fakeRincon) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.down.Load() {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[r.Method+" "+r.URL.Path]++
+	f.headers[r.Method+" "+r.URL.Path] = r.Header.Clone()
+	if f.fail.Load() {
+		writeFake(w, http.StatusInternalServerError, map[string]string{"message": "internal error"})
+		return
+	}
+	segments := match.Segments(r.URL.Path)
+	switch {
+	case r.URL.Path == "/rincon/ping":
+		writeFake(w, http.StatusOK, Ping{Message: "Rincon is online", Services: len(f.services), Routes: len(f.routes)})
+	case r.URL.Path == "/rincon/services" && r.Method == http.MethodGet:
+		services := make([]Service, 0)
+		for id := 1; id < f.nextID; id++ {
+			if service, ok := f.services[id]; ok {
+				services = append(services, service)
+			}
+		}
+		writeFake(w, http.StatusOK, services)
+	case r.URL.Path == "/rincon/services" && r.Method == http.MethodPost:
+		var service Service
+		json.NewDecoder(r.Body).Decode(&service)
+		if service.ID == 0 {
+			service.ID = f.nextID
+		}
+		if service.ID >= f.nextID {
+			f.nextID = service.ID + 1
+		}
+		now := time.Now().UTC().Truncate(time.Second)
+		service.CreatedAt = now
+		service.UpdatedAt = now
+		f.services[service.ID] = service
+		writeFake(w, http.StatusOK, service)
+	case len(segments) == 3 && segments[1] == "services" && r.Method == http.MethodDelete:
+		id, _ := strconv.Atoi(segments[2])
+		if _, ok := f.services[id]; !ok {
+			writeFake(w, http.StatusNotFound, map[string]string{"message": "no service with id " + segments[2]})
+			return
+		}
+		delete(f.services, id)
+		kept := f.routes[:0]
+		for _, route := range f.routes {
+			if len(f.instancesLocked(route.ServiceName)) > 0 {
+				kept = append(kept, route)
+			}
+		}
+		f.routes = kept
+		writeFake(w, http.StatusOK, map[string]string{"message": "deleted"})
+	case len(segments) == 3 && segments[1] == "services":
+		writeFake(w, http.StatusOK, f.instancesLocked(segments[2]))
+	case len(segments) == 4 && segments[1] == "services" && segments[3] == "routes":
+		routes := make([]Route, 0)
+		for _, route := range f.routes {
+			if route.ServiceName == segments[2] {
+				routes = append(routes, route)
+			}
+		}
+		writeFake(w, http.StatusOK, routes)
+	case r.URL.Path == "/rincon/routes" && r.Method == http.MethodPost:
+		var route Route
+		json.NewDecoder(r.Body).Decode(&route)
+		for _, existing := range f.routes {
+			if existing.Route == route.Route && existing.Method == route.Method && existing.ServiceName == route.ServiceName {
+				writeFake(w, http.StatusOK, route)
+				return
+			}
+		}
+		route.CreatedAt = time.Now().UTC().Truncate(time.Second)
+		f.routes = append(f.routes, route)
+		writeFake(w, http.StatusOK, route)
+	case r.URL.Path == "/rincon/routes":
+		writeFake(w, http.StatusOK, append([]Route{}, f.routes...))
+	case r.URL.Path == "/rincon/match":
+		matched, ok := fakeMatch(f.routes, r.URL.Query().Get("route"), r.URL.Query().Get("method"))
+		instances := f.instancesLocked(matched.ServiceName)
+		if !ok || len(instances) == 0 {
+			writeFake(w, http.StatusNotFound, map[string]string{"message": "no route found"})
+			return
+		}
+		writeFake(w, http.StatusOK, instances[0])
+	default:
+		writeFake(w, http.StatusNotFound, map[string]string{"message": "not found"})
+	}
+}
+
+// fakeMatch matches a request the way Rincon documents it, independently
+// of the match package: every route is tried, and of the routes that match,
+// the one whose segments are most specific from left to right wins, exact
+// before "*" before "**". At the same pattern, a route registered for the
+// method wins over one registered for every method, and then the first
+// registered wins.
+func fakeMatch(routes []Route, path, method string) (Route, bool) {
+	method = strings.ToUpper(method)
+	best := -1
+	var bestRank []int
+	bestEvery := false
+	for i, route := range routes {
+		rank, ok := fakeRank(fakeSegments(route.Route), fakeSegments(path))
+		if !ok {
+			continue
+		}
+		every, ok := fakeMethod(route.Method, method)
+		if !ok {
+			continue
+		}
+		order := compareFakeRanks(rank, bestRank)
+		if best < 0 || order < 0 || order == 0 && bestEvery && !every {
+			best, bestRank, bestEvery = i, rank, every
+		}
+	}
+	if best < 0 {
+		return Route{}, false
+	}
+	return routes[best], true
+}
+
+func fakeSegments(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+}
+
+// fakeRank reports whether the pattern matches the path, and ranks each
+// pattern segment: 0 for exact, 1 for "*" and 2 for "**".
+func fakeRank(pattern, path []string) ([]int, bool) {
+	var rank []int
+	for i, segment := range pattern {
+		switch {
+		case segment == "**":
+			return append(rank, 2), i == len(pattern)-1
+		case i >= len(path):
+			return nil, false
+		case segment == "*":
+			rank = append(rank, 1)
+		case segment == path[i]:
+			rank = append(rank, 0)
+		default:
+			return nil, false
+		}
+	}
+	return rank, len(pattern) == len(path)
+}
+
+func compareFakeRanks(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return len(a) - len(b)
+}
+
+// fakeMethod reports whether a route registered for the comma separated
+// methods handles the method, and whether only because of "*".
+func fakeMethod(methods, method string) (every, ok bool) {
+	for _, m := range strings.Split(methods, ",") {
+		switch strings.ToUpper(strings.TrimSpace(m)) {
+		case "*":
+			every = true
+		case method:
+			return false, true
+		}
+	}
+	return every, every
+}
+
+// TestProbesAgreeWithFake checks the match package against the fake's
+// matcher, the same way the check-match command checks it against Rincon.
+func TestProbesAgreeWithFake(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	f.routes = []Route{
+		{Route: "/orders", Method: "GET,POST", ServiceName: "orders"},
+		{Route: "/orders/*", Method: "*", ServiceName: "order"},
+		{Route: "/orders/*/items/**", Method: "GET", ServiceName: "items"},
+		{Route: "/orders/new", Method: "POST", ServiceName: "create"},
+		{Route: "/users/**", Method: "*", ServiceName: "users"},
+		{Route: "/users/me", Method: "GET", ServiceName: "me"},
+		{Route: "/**", Method: "GET", ServiceName: "fallback"},
+	}
+	for _, route := range f.routes {
+		f.add(Service{Name: route.ServiceName, Endpoint: "http://" + route.ServiceName + ":8080"})
+	}
+
+	table := match.NewTable(matchRoutes(f.routes))
+	probes := match.Probes(matchRoutes(f.routes))
+	if len(probes) == 0 {
+		t.Fatal("no probes")
+	}
+	for _, probe := range probes {
+		local, ok := table.Match(probe.Path, probe.Method)
+		service, err := client.LookupRoute(context.Background(), probe.Path, probe.Method)
+		if !ok {
+			if err == nil {
+				t.Errorf("%s %s: no local match, fake matched %s", probe.Method, probe.Path, service.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: local match %s, fake: %s", probe.Method, probe.Path, local.Service, err)
+		} else if service.Name != local.Service {
+			t.Errorf("%s %s: local match %s, fake matched %s", probe.Method, probe.Path, local.Service, service.Name)
+		}
+	}
+}
+
+func writeFake(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// eventually fails the test if cond does not become true within a second.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
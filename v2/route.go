@@ -1,9 +1,12 @@
 package rincon
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/bk1031/rincon-go/v2/match"
 )
 
 type Route struct {
@@ -16,22 +19,39 @@ type Route struct {
 // Routes returns the routes registered for the client's service.
 // If the client is not registered, an error will be returned.
 func (c *Client) Routes() ([]Route, error) {
-	if c.service == nil {
+	service := c.Service()
+	if service == nil {
 		return nil, fmt.Errorf("client is not registered")
 	}
-	return c.RoutesForService(c.service.Name)
+	return c.RoutesForService(service.Name)
 }
 
 // RegisterRoute registers a route for the client's service.
+// The route and method are validated and canonicalized with
+// ParseRoutePattern before they are sent.
 // If the client is not already registered, an error will be returned.
+// Other failures are also reported to the OnRouteRegistrationFailed hooks.
 func (c *Client) RegisterRoute(route string, method string) error {
-	if c.service == nil {
+	service := c.Service()
+	if service == nil {
 		return fmt.Errorf("client is not registered")
 	}
+	err := c.registerRoute(service.Name, route, method)
+	if err != nil {
+		c.fireRouteRegistrationFailed(Route{Route: route, ServiceName: service.Name, Method: method}, err)
+	}
+	return err
+}
+
+func (c *Client) registerRoute(serviceName string, route string, method string) error {
+	pattern, err := ParseRoutePattern(route, method)
+	if err != nil {
+		return err
+	}
 	req, err := c.newRequest("POST", "/rincon/routes", Route{
-		Route:       route,
-		ServiceName: c.service.Name,
-		Method:      method,
+		Route:       pattern.Route(),
+		ServiceName: serviceName,
+		Method:      pattern.Method(),
 	}, nil)
 	if err != nil {
 		return err
@@ -44,40 +64,112 @@ func (c *Client) RegisterRoute(route string, method string) error {
 		return fmt.Errorf("[%d] %s", apiError.StatusCode, apiError.Message)
 	}
 
+	c.recordRoute(Route{Route: pattern.Route(), ServiceName: serviceName, Method: pattern.Method()})
 	return nil
 }
 
+// recordRoute records a route registered for the client's service, to be
+// registered again when the client reconnects to Rincon.
+func (c *Client) recordRoute(route Route) {
+	c.serviceMu.Lock()
+	defer c.serviceMu.Unlock()
+	for _, existing := range c.routes {
+		if existing.Route == route.Route && existing.Method == route.Method {
+			return
+		}
+	}
+	c.routes = append(c.routes, route)
+}
+
+// registeredRoutes returns the routes registered for the client's service.
+func (c *Client) registeredRoutes() []Route {
+	c.serviceMu.RLock()
+	defer c.serviceMu.RUnlock()
+	return append([]Route(nil), c.routes...)
+}
+
 // MatchRoute returns the service that is registered to handle the given route.
+// If Rincon is unreachable or the client is Disconnected, and a Snapshot is
+// loaded, the route is matched against the snapshot and the service is
+// marked as stale.
 func (c *Client) MatchRoute(route string, method string) (*Service, error) {
-	if c.service == nil {
+	return c.MatchRouteContext(context.Background(), route, method)
+}
+
+// MatchRouteContext is like MatchRoute, but sends the request to Rincon
+// with the given context. A trace context set with ContextWithTrace
+// becomes the parent of the request's span.
+// If the client is not registered, an error will be returned.
+func (c *Client) MatchRouteContext(ctx context.Context, route string, method string) (*Service, error) {
+	if !c.IsRegistered() {
 		return nil, fmt.Errorf("client is not registered")
 	}
-	route = strings.TrimPrefix(route, "/")
-	route = strings.TrimSuffix(route, "/")
+	return c.LookupRoute(ctx, route, method)
+}
+
+// LookupRoute is like MatchRouteContext, but does not require the client
+// to be registered, for tools that only inspect the registry, such as the
+// rincon command.
+func (c *Client) LookupRoute(ctx context.Context, route string, method string) (*Service, error) {
+	service, apiError, err := c.matchRoute(ctx, route, method)
+	if err != nil {
+		return nil, err
+	} else if apiError != nil {
+		return nil, fmt.Errorf("[%d] %s", apiError.StatusCode, apiError.Message)
+	}
+	return service, nil
+}
+
+// matchRoute asks Rincon for the service that handles the route, falling
+// back to the snapshot as described for MatchRoute. An error response from
+// Rincon, such as 404 when no route matches, is returned as an
+// *ErrorResponse.
+func (c *Client) matchRoute(ctx context.Context, route string, method string) (*Service, *ErrorResponse, error) {
+	// Request paths are not validated as patterns, since they may contain
+	// any character; they are only trimmed and their slashes collapsed.
+	route = strings.Join(match.Segments(route), "/")
+	if c.State() == Disconnected {
+		if stale, ok := c.snapshotMatch(route, method); ok {
+			return stale, nil, nil
+		}
+	}
 	req, err := c.newRequest("GET", "/rincon/match", nil, map[string]string{
 		"route":  route,
 		"method": method,
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	req = req.WithContext(ctx)
 
 	var service Service
 	_, apiError, err := c.do(req, &service)
 	if err != nil {
-		return nil, err
+		if isUnreachable(err) {
+			if stale, ok := c.snapshotMatch(route, method); ok {
+				return stale, nil, nil
+			}
+		}
+		return nil, nil, err
 	} else if apiError != nil {
-		return nil, fmt.Errorf("[%d] %s", apiError.StatusCode, apiError.Message)
+		return nil, apiError, nil
 	}
-	return &service, nil
+	return &service, nil, nil
 }
 
 // RoutesForService returns the routes registered for the given service.
 func (c *Client) RoutesForService(serviceName string) ([]Route, error) {
+	return c.RoutesForServiceContext(context.Background(), serviceName)
+}
+
+// RoutesForServiceContext is like RoutesForService, but sends the request
+// to Rincon with the given context.
+func (c *Client) RoutesForServiceContext(ctx context.Context, serviceName string) ([]Route, error) {
 	req, err := c.newRequest("GET", "/rincon/services/"+serviceName+"/routes", nil, nil)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 
 	var routes []Route
 	_, apiError, err := c.do(req, &routes)
@@ -89,3 +181,171 @@ func (c *Client) RoutesForService(serviceName string) ([]Route, error) {
 
 	return routes, nil
 }
+
+// ListRoutes returns every route registered with Rincon.
+func (c *Client) ListRoutes() ([]Route, error) {
+	return c.ListRoutesContext(context.Background())
+}
+
+// ListRoutesContext is like ListRoutes, but sends the request to Rincon
+// with the given context.
+func (c *Client) ListRoutesContext(ctx context.Context) ([]Route, error) {
+	req, err := c.newRequest("GET", "/rincon/routes", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	routes := make([]Route, 0)
+	_, apiError, err := c.do(req, &routes)
+	if err != nil {
+		return nil, err
+	} else if apiError != nil {
+		return nil, fmt.Errorf("[%d] %s", apiError.StatusCode, apiError.Message)
+	}
+
+	return routes, nil
+}
+
+// MatchRouteLocal returns the service that is registered to handle the given
+// route, matching it against the routes of the latest Snapshot instead of
+// calling Rincon. The snapshot is refreshed every SnapshotInterval seconds.
+func (c *Client) MatchRouteLocal(route string, method string) (*Service, error) {
+	if c.currentSnapshot() == nil {
+		return nil, fmt.Errorf("no snapshot loaded")
+	}
+	service, ok := c.localMatch(route, method)
+	if !ok {
+		return nil, fmt.Errorf("no route matches %s %s", method, route)
+	}
+	return service, nil
+}
+
+// localMatch matches the route against the local route table and returns
+// the first instance of the matched service from the current snapshot.
+func (c *Client) localMatch(route, method string) (*Service, bool) {
+	snapshot := c.currentSnapshot()
+	if snapshot == nil {
+		return nil, false
+	}
+	matched, ok := c.routeTable.Match(route, method)
+	if !ok {
+		return nil, false
+	}
+	for _, service := range snapshot.Services {
+		if service.Name == matched.Service {
+			return &service, true
+		}
+	}
+	return nil, false
+}
+
+// MatchResult explains how a route was matched.
+type MatchResult struct {
+	// Service is the service that handles the route.
+	Service *Service
+	// Route is the registered route pattern that matched.
+	Route Route
+	// Params are the request segments captured by each "*" segment of the
+	// pattern, in order, followed by the path captured by a "**" segment.
+	Params []string
+	// Candidates are every registered route that matches the request,
+	// in order of precedence.
+	Candidates []Route
+}
+
+// MatchRouteDetailed returns the service that is registered to handle the
+// given route, together with the pattern that matched, the segments its
+// wildcards captured and the other candidate routes. The service comes from
+// Rincon, while the explanation is computed from the route table of the
+// latest Snapshot. If no snapshot is loaded, the routes are fetched from
+// Rincon and reused for fetchedTableTTL.
+func (c *Client) MatchRouteDetailed(route string, method string) (*MatchResult, error) {
+	return c.MatchRouteDetailedContext(context.Background(), route, method)
+}
+
+// MatchRouteDetailedContext is like MatchRouteDetailed, but sends the
+// request to Rincon with the given context. Unlike MatchRouteContext, it
+// does not require the client to be registered.
+func (c *Client) MatchRouteDetailedContext(ctx context.Context, route string, method string) (*MatchResult, error) {
+	result, apiError, err := c.matchRouteDetailed(ctx, route, method)
+	if err != nil {
+		return nil, err
+	} else if apiError != nil {
+		return nil, fmt.Errorf("[%d] %s", apiError.StatusCode, apiError.Message)
+	}
+	return result, nil
+}
+
+// matchRouteDetailed is like matchRoute, but explains the match as
+// described for MatchRouteDetailed.
+func (c *Client) matchRouteDetailed(ctx context.Context, route string, method string) (*MatchResult, *ErrorResponse, error) {
+	service, apiError, err := c.matchRoute(ctx, route, method)
+	if err != nil || apiError != nil {
+		return nil, apiError, err
+	}
+	table, err := c.explainTable(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &MatchResult{Service: service}
+	explained := table.Explain(route, method)
+	winner := -1
+	for i, candidate := range explained {
+		result.Candidates = append(result.Candidates, Route{
+			Route:       candidate.Route.Route,
+			ServiceName: candidate.Route.Service,
+			Method:      candidate.Route.Method,
+		})
+		if winner < 0 && candidate.Route.Service == service.Name {
+			winner = i
+		}
+	}
+	if winner < 0 && len(explained) > 0 {
+		winner = 0
+	}
+	if winner >= 0 {
+		result.Route = result.Candidates[winner]
+		result.Params = explained[winner].Params
+	}
+	return result, nil, nil
+}
+
+// fetchedTableTTL is how long the routes fetched to explain a match are
+// reused while no Snapshot is loaded.
+const fetchedTableTTL = 5 * time.Second
+
+// explainTable returns the route table used to explain a match: the table
+// of the current snapshot, or else the routes fetched from Rincon within
+// the last fetchedTableTTL, fetching them again with ctx if they are older.
+func (c *Client) explainTable(ctx context.Context) (*match.Table, error) {
+	if c.currentSnapshot() != nil {
+		return c.routeTable, nil
+	}
+	c.fetchedMu.Lock()
+	defer c.fetchedMu.Unlock()
+	if c.fetchedTable != nil && time.Since(c.fetchedAt) < fetchedTableTTL {
+		return c.fetchedTable, nil
+	}
+	routes, err := c.ListRoutesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.fetchedTable = match.NewTable(matchRoutes(routes))
+	c.fetchedAt = time.Now()
+	return c.fetchedTable, nil
+}
+
+// matchRoutes converts routes to the form used by the match package.
+func matchRoutes(routes []Route) []match.Route {
+	converted := make([]match.Route, len(routes))
+	for i, route := range routes {
+		converted[i] = match.Route{
+			Route:   route.Route,
+			Method:  route.Method,
+			Service: route.ServiceName,
+		}
+	}
+	return converted
+}
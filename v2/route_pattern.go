@@ -0,0 +1,146 @@
+package rincon
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RoutePattern is a parsed and validated route with its set of methods.
+//
+// A route is a slash separated list of segments. A "*" segment matches any
+// single segment and a "**" segment, which must be the last one, matches
+// any number of remaining segments. Wildcards cannot be combined with
+// other characters in a segment. Leading and trailing slashes are ignored.
+//
+// Methods are given as a comma separated set of HTTP methods in any case.
+// "*" and "ANY" mean every method.
+type RoutePattern struct {
+	// Segments are the segments of the route, without slashes.
+	Segments []string
+	// Methods are the upper-cased methods of the pattern in canonical
+	// order. It is nil if the pattern matches every method.
+	Methods []string
+}
+
+// knownMethods are the methods accepted in a RoutePattern, in the order
+// they appear in its canonical form.
+var knownMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE"}
+
+// ParseRoutePattern parses and validates the given route and method set.
+// An empty method set means every method.
+func ParseRoutePattern(route string, method string) (RoutePattern, error) {
+	segments, err := parseSegments(route)
+	if err != nil {
+		return RoutePattern{}, err
+	}
+	methods, err := parseMethods(method)
+	if err != nil {
+		return RoutePattern{}, err
+	}
+	return RoutePattern{Segments: segments, Methods: methods}, nil
+}
+
+// Route returns the canonical form of the route, such as "/users/*".
+func (p RoutePattern) Route() string {
+	return "/" + strings.Join(p.Segments, "/")
+}
+
+// Method returns the canonical form of the method set, such as "GET,POST",
+// or "*" if the pattern matches every method.
+func (p RoutePattern) Method() string {
+	if p.Methods == nil {
+		return "*"
+	}
+	return strings.Join(p.Methods, ",")
+}
+
+// String returns the canonical method set and route, such as "GET /users/*".
+func (p RoutePattern) String() string {
+	return p.Method() + " " + p.Route()
+}
+
+// HasWildcard returns true if the route contains a "*" or "**" segment.
+func (p RoutePattern) HasWildcard() bool {
+	for _, segment := range p.Segments {
+		if segment == "*" || segment == "**" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSegments splits a route into validated segments.
+func parseSegments(route string) ([]string, error) {
+	trimmed := strings.Trim(route, "/")
+	if trimmed == "" {
+		return []string{}, nil
+	}
+	segments := strings.Split(trimmed, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "":
+			return nil, fmt.Errorf("invalid route %q: empty segment", route)
+		case segment == "**":
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("invalid route %q: ** must be the last segment", route)
+			}
+		case segment == "*":
+		case strings.Contains(segment, "*"):
+			return nil, fmt.Errorf("invalid route %q: wildcard must be a whole segment in %q", route, segment)
+		default:
+			for _, r := range segment {
+				if !isSegmentChar(r) {
+					return nil, fmt.Errorf("invalid route %q: character %q not allowed in segment %q", route, r, segment)
+				}
+			}
+		}
+	}
+	return segments, nil
+}
+
+// isSegmentChar reports whether r may appear in a route segment. These are
+// the unreserved and sub-delimiter characters of RFC 3986, plus ':', '@'
+// and '%' for percent encoding.
+func isSegmentChar(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("-._~!$&'()+,;=:@%", r)
+}
+
+// parseMethods normalizes a comma separated method set. It returns nil if
+// the set matches every method.
+func parseMethods(method string) ([]string, error) {
+	found := make(map[string]bool)
+	for _, m := range strings.Split(method, ",") {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		switch {
+		case m == "":
+			continue
+		case m == "*" || m == "ANY":
+			return nil, nil
+		}
+		known := false
+		for _, k := range knownMethods {
+			if m == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("invalid method %q", m)
+		}
+		found[m] = true
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	methods := make([]string, 0, len(found))
+	for _, k := range knownMethods {
+		if found[k] {
+			methods = append(methods, k)
+		}
+	}
+	return methods, nil
+}
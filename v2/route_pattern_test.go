@@ -0,0 +1,78 @@
+package rincon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRoutePattern(t *testing.T) {
+	tests := []struct {
+		route  string
+		method string
+		want   string
+		ok     bool
+	}{
+		{"/users", "get", "GET /users", true},
+		{"users/*/", "post, get", "GET,POST /users/*", true},
+		{"/users/**", "", "* /users/**", true},
+		{"/", "ANY", "* /", true},
+		{"", "GET,*", "* /", true},
+		{"/files/v1.2~beta:latest", "GET", "GET /files/v1.2~beta:latest", true},
+		{"/users//me", "GET", "", false},
+		{"/users/**/me", "GET", "", false},
+		{"/users/a*", "GET", "", false},
+		{"/users/a b", "GET", "", false},
+		{"/users?id=1", "GET", "", false},
+		{"/users", "FETCH", "", false},
+	}
+	for _, tt := range tests {
+		pattern, err := ParseRoutePattern(tt.route, tt.method)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseRoutePattern(%q, %q) error = %v, want ok %v", tt.route, tt.method, err, tt.ok)
+			continue
+		}
+		if tt.ok && pattern.String() != tt.want {
+			t.Errorf("ParseRoutePattern(%q, %q) = %s, want %s", tt.route, tt.method, pattern, tt.want)
+		}
+	}
+}
+
+func TestRoutePatternHasWildcard(t *testing.T) {
+	tests := map[string]bool{
+		"/users":      false,
+		"/users/*":    true,
+		"/users/**":   true,
+		"/users/me/*": true,
+	}
+	for route, want := range tests {
+		pattern, err := ParseRoutePattern(route, "GET")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pattern.HasWildcard(); got != want {
+			t.Errorf("%s HasWildcard() = %v, want %v", route, got, want)
+		}
+	}
+}
+
+func FuzzParseRoutePattern(f *testing.F) {
+	f.Add("/users/*", "GET")
+	f.Add("/users/**", "get,post")
+	f.Add("//a//b/", "*")
+	f.Add("/a/**/b", "ANY")
+	f.Add("/a*b", "PUT, DELETE")
+	f.Add("", "")
+	f.Fuzz(func(t *testing.T, route, method string) {
+		pattern, err := ParseRoutePattern(route, method)
+		if err != nil {
+			return
+		}
+		again, err := ParseRoutePattern(pattern.Route(), pattern.Method())
+		if err != nil {
+			t.Fatalf("canonical form %s of %q %q does not parse: %s", pattern, method, route, err)
+		}
+		if !reflect.DeepEqual(again, pattern) {
+			t.Fatalf("round trip of %q %q = %#v, want %#v", method, route, again, pattern)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package rincon
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMatchRouteAcceptsRequestPaths(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	if _, err := client.Register(Service{Name: "files", Endpoint: "http://files:8080"}, []Route{{Route: "/files/**", Method: "GET"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/files/a b.txt", "//files///report (1).pdf/", "/files/ünïcode", "/files/a*b"} {
+		service, err := client.MatchRouteContext(context.Background(), path, "GET")
+		if err != nil {
+			t.Errorf("MatchRoute(%q): %s", path, err)
+			continue
+		}
+		if service.Name != "files" {
+			t.Errorf("MatchRoute(%q) = %s, want files", path, service.Name)
+		}
+	}
+}
+
+func TestMatchRouteRequiresRegistration(t *testing.T) {
+	f := newFakeRincon(t)
+	f.add(Service{Name: "files", Endpoint: "http://files:8080"})
+	f.routes = append(f.routes, Route{Route: "files/**", ServiceName: "files", Method: "GET"})
+	client := newTestClient(t, f, Config{})
+
+	if _, err := client.MatchRoute("/files/a", "GET"); err == nil || err.Error() != "client is not registered" {
+		t.Fatalf("MatchRoute while unregistered: err = %v, want client is not registered", err)
+	}
+	service, err := client.LookupRoute(context.Background(), "/files/a", "GET")
+	if err != nil {
+		t.Fatalf("LookupRoute: %s", err)
+	}
+	if service.Name != "files" {
+		t.Fatalf("LookupRoute = %s, want files", service.Name)
+	}
+	if _, err := client.LookupRoute(context.Background(), "/users", "GET"); err == nil || err.Error() != "[404] no route found" {
+		t.Fatalf("LookupRoute of an unknown route: err = %v, want [404] no route found", err)
+	}
+}
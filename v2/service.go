@@ -1,8 +1,8 @@
 package rincon
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +16,9 @@ type Service struct {
 	HealthCheck string    `json:"health_check"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	CreatedAt   time.Time `json:"created_at"`
+	// Stale is true if the service was served from a Snapshot because
+	// Rincon was unreachable.
+	Stale bool `json:"-"`
 }
 
 // FormattedName returns the name of the service formatted to use
@@ -32,17 +35,38 @@ func (s Service) FormattedName() string {
 }
 
 // FormattedNameWithVersion returns the formatted name of the service with
-// its version string appended.
+// its version string appended. A leading "v" in the version is not repeated.
 func (s Service) FormattedNameWithVersion() string {
-	return fmt.Sprintf("%s v%s", s.FormattedName(), s.Version)
+	return fmt.Sprintf("%s v%s", s.FormattedName(), strings.TrimPrefix(s.Version, "v"))
 }
 
 // Service returns the current service registration of the client.
 // If the client is not registered, it will be nil.
 func (c *Client) Service() *Service {
+	c.serviceMu.RLock()
+	defer c.serviceMu.RUnlock()
 	return c.service
 }
 
+// setService stores the registration of the client, or clears it and its
+// routes if service is nil.
+func (c *Client) setService(service *Service) {
+	c.serviceMu.Lock()
+	defer c.serviceMu.Unlock()
+	c.service = service
+	if service != nil {
+		c.userAgent = fmt.Sprintf("%s-%d", service.Name, service.ID)
+	} else {
+		c.routes = nil
+	}
+}
+
+func (c *Client) currentUserAgent() string {
+	c.serviceMu.RLock()
+	defer c.serviceMu.RUnlock()
+	return c.userAgent
+}
+
 // Rincon returns the Rincon server instance that the client is connected to.
 func (c *Client) Rincon() *Service {
 	return c.rincon
@@ -50,11 +74,24 @@ func (c *Client) Rincon() *Service {
 
 // IsRegistered returns true if the client is registered.
 func (c *Client) IsRegistered() bool {
-	return c.service != nil
+	return c.Service() != nil
 }
 
 // Register registers the client with the given service definition and routes.
+// Every route is validated with ParseRoutePattern and checked for
+// conflicts according to the ConflictPolicy before the service is
+// registered. On the first registration, an instance left over from a
+// previous run is reused or replaced according to the IdentityPolicy.
 func (c *Client) Register(service Service, routes []Route) (int, error) {
+	for _, route := range routes {
+		if _, err := ParseRoutePattern(route.Route, route.Method); err != nil {
+			return 0, err
+		}
+	}
+	if err := c.applyConflictPolicy(service, routes); err != nil {
+		return 0, err
+	}
+	c.applyIdentityPolicy(&service)
 	req, err := c.newRequest("POST", "/rincon/services", service, nil)
 	if err != nil {
 		return 0, err
@@ -68,28 +105,67 @@ func (c *Client) Register(service Service, routes []Route) (int, error) {
 		return 0, fmt.Errorf("[%d] %s", apiError.StatusCode, apiError.Message)
 	}
 
-	c.service = newService
-	c.userAgent = fmt.Sprintf("%s-%d", newService.Name, newService.ID)
+	previous := c.Service()
+	registered := previous == nil || previous.ID != newService.ID
+	if registered {
+		c.saveInstanceState(newService)
+	}
+	c.setService(newService)
+	c.draining.Store(false)
+	if registered {
+		c.fireRegistered(*newService)
+	}
 	for _, route := range routes {
 		err = c.RegisterRoute(route.Route, route.Method)
 		if err != nil {
-			log.Printf("failed to register route %s: %s", route, err)
+			c.logger.Printf("failed to register route %s %s: %s", route.Method, route.Route, err)
 		}
 	}
-	c.StartHeartbeat()
+	if c.heartbeatMode == ServerHeartbeat {
+		c.startWatchdog()
+	} else {
+		c.StartHeartbeat()
+	}
 	return newService.ID, nil
 }
 
 // Deregister deregisters the client from the Rincon server.
 func (c *Client) Deregister() error {
-	if c.service == nil {
+	return c.DeregisterContext(context.Background())
+}
+
+// DeregisterContext is like Deregister, but sends the request to Rincon
+// with the given context, so that shutdown is not held up by a slow or
+// unreachable server.
+func (c *Client) DeregisterContext(ctx context.Context) error {
+	service := c.Service()
+	if service == nil {
 		return fmt.Errorf("client is not registered")
 	}
 
-	req, err := c.newRequest("DELETE", "/rincon/services/"+strconv.Itoa(c.service.ID), nil, nil)
+	if err := c.deregisterByID(ctx, service.ID); err != nil {
+		return err
+	}
+
+	c.stopWatchdog()
+	c.clearInstanceState()
+	c.fireDeregistered(*service)
+	c.setService(nil)
+	return nil
+}
+
+// DeregisterByID removes the service instance with the given ID from the
+// Rincon server. It does not affect the client's own registration.
+func (c *Client) DeregisterByID(id int) error {
+	return c.deregisterByID(context.Background(), id)
+}
+
+func (c *Client) deregisterByID(ctx context.Context, id int) error {
+	req, err := c.newRequest("DELETE", "/rincon/services/"+strconv.Itoa(id), nil, nil)
 	if err != nil {
 		return err
 	}
+	req = req.WithContext(ctx)
 
 	_, apiError, err := c.do(req, nil)
 	if err != nil {
@@ -98,23 +174,82 @@ func (c *Client) Deregister() error {
 		return fmt.Errorf("[%d] %s", apiError.StatusCode, apiError.Message)
 	}
 
-	c.service = nil
 	return nil
 }
 
-func (c *Client) GetServicesByName(name string) ([]Service, error) {
+// ListServices returns every service instance registered with Rincon.
+func (c *Client) ListServices() ([]Service, error) {
+	req, err := c.newRequest("GET", "/rincon/services", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]Service, 0)
+	_, apiError, err := c.do(req, &services)
+	if err != nil {
+		return nil, err
+	} else if apiError != nil {
+		return nil, fmt.Errorf("[%d] %s", apiError.StatusCode, apiError.Message)
+	}
+
+	return services, nil
+}
+
+// GetServicesByName returns the registered instances of the named service.
+// If version constraints such as ">=2.3 <3" are given, only instances whose
+// Version satisfies all of them are returned, newest version first.
+// If Rincon is unreachable or the client is Disconnected, and a Snapshot is
+// loaded, the instances are served from the snapshot and marked as stale.
+func (c *Client) GetServicesByName(name string, constraints ...string) ([]Service, error) {
+	return c.GetServicesByNameContext(context.Background(), name, constraints...)
+}
+
+// GetServicesByNameContext is like GetServicesByName, but sends the request
+// to Rincon with the given context. A trace context set with
+// ContextWithTrace becomes the parent of the request's span.
+func (c *Client) GetServicesByNameContext(ctx context.Context, name string, constraints ...string) ([]Service, error) {
+	parsed := make([]Constraint, len(constraints))
+	for i, constraint := range constraints {
+		var err error
+		if parsed[i], err = ParseConstraint(constraint); err != nil {
+			return nil, err
+		}
+	}
+	services, err := c.getServicesByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, constraint := range parsed {
+		services = constraint.FilterServices(services)
+	}
+	return services, nil
+}
+
+func (c *Client) getServicesByName(ctx context.Context, name string) ([]Service, error) {
+	if c.State() == Disconnected {
+		if stale, ok := c.snapshotServices(name); ok {
+			return stale, nil
+		}
+	}
 	services := make([]Service, 0)
 	req, err := c.newRequest("GET", "/rincon/services/"+name, services, nil)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 
 	_, apiError, err := c.do(req, &services)
 	if err != nil {
+		if isUnreachable(err) {
+			if stale, ok := c.snapshotServices(name); ok {
+				return stale, nil
+			}
+		}
 		return nil, err
 	} else if apiError != nil {
 		return nil, fmt.Errorf("[%d] %s", apiError.StatusCode, apiError.Message)
 	}
 
+	c.observeInstances(name, services)
 	return services, nil
 }
@@ -0,0 +1,177 @@
+package rincon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Snapshot is a point-in-time copy of the services and routes registered
+// with Rincon. When a snapshot is loaded, lookups that fail because Rincon
+// is unreachable are served from it instead.
+type Snapshot struct {
+	Services []Service `json:"services"`
+	Routes   []Route   `json:"routes"`
+	TakenAt  time.Time `json:"taken_at"`
+}
+
+// Snapshot fetches every service and route from Rincon and stores them as
+// the client's current snapshot. If the Config has a SnapshotPath, the
+// snapshot is also written to it.
+func (c *Client) Snapshot() (*Snapshot, error) {
+	services, err := c.ListServices()
+	if err != nil {
+		return nil, err
+	}
+	routes, err := c.ListRoutes()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{
+		Services: services,
+		Routes:   routes,
+		TakenAt:  time.Now(),
+	}
+	c.setSnapshot(snapshot)
+	if c.snapshotPath != "" {
+		if err = writeJSONFile(c.snapshotPath, snapshot); err != nil {
+			return snapshot, err
+		}
+	}
+	return snapshot, nil
+}
+
+// LoadSnapshot reads a JSON encoded Snapshot from r and stores it as the
+// client's current snapshot.
+func (c *Client) LoadSnapshot(r io.Reader) error {
+	snapshot := new(Snapshot)
+	if err := json.NewDecoder(r).Decode(snapshot); err != nil {
+		return err
+	}
+	c.setSnapshot(snapshot)
+	return nil
+}
+
+// setSnapshot stores the snapshot and rebuilds the local route table
+// from its routes.
+func (c *Client) setSnapshot(snapshot *Snapshot) {
+	c.snapshotMu.Lock()
+	c.snapshot = snapshot
+	c.snapshotMu.Unlock()
+	c.routeTable.Replace(matchRoutes(snapshot.Routes))
+	byName := make(map[string][]Service)
+	for _, service := range snapshot.Services {
+		byName[service.Name] = append(byName[service.Name], service)
+	}
+	for name, services := range byName {
+		c.observeInstances(name, services)
+	}
+}
+
+func (c *Client) currentSnapshot() *Snapshot {
+	c.snapshotMu.RLock()
+	defer c.snapshotMu.RUnlock()
+	return c.snapshot
+}
+
+// loadSnapshotFile loads the snapshot at the client's SnapshotPath.
+// A missing file is not an error.
+func (c *Client) loadSnapshotFile() error {
+	file, err := os.Open(c.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	return c.LoadSnapshot(file)
+}
+
+// writeJSONFile atomically replaces the file at path with the JSON
+// encoding of v, by writing a temporary file in the same directory and
+// renaming it into place.
+func writeJSONFile(path string, v interface{}) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	encoder := json.NewEncoder(tmp)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// refreshSnapshots takes a new snapshot once per SnapshotInterval until
+// the client is closed.
+func (c *Client) refreshSnapshots() {
+	ticker := time.NewTicker(time.Duration(c.snapshotInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if _, err := c.Snapshot(); err != nil {
+				c.logger.Printf("failed to refresh snapshot: %s", err)
+			}
+		}
+	}
+}
+
+// isUnreachable reports whether err means the Rincon server could not be
+// reached, as opposed to the server returning an error. A request given up
+// because its context was canceled or timed out is not treated as
+// unreachable, so that the caller gets the context's error instead of a
+// stale answer from the snapshot.
+func isUnreachable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// snapshotServices returns the instances of the named service from the
+// current snapshot, marked as stale. It reports false if no snapshot is
+// loaded or the snapshot has no instance of the service, so that the
+// caller asks Rincon or returns its error instead of an empty list.
+func (c *Client) snapshotServices(name string) ([]Service, bool) {
+	snapshot := c.currentSnapshot()
+	if snapshot == nil {
+		return nil, false
+	}
+	services := make([]Service, 0)
+	for _, service := range snapshot.Services {
+		if service.Name == name {
+			service.Stale = true
+			services = append(services, service)
+		}
+	}
+	return services, len(services) > 0
+}
+
+// snapshotMatch returns the service that handles the given route according
+// to the current snapshot, marked as stale.
+func (c *Client) snapshotMatch(route, method string) (*Service, bool) {
+	service, ok := c.localMatch(route, method)
+	if ok {
+		service.Stale = true
+	}
+	return service, ok
+}
@@ -0,0 +1,122 @@
+package rincon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotWrittenOnStartup(t *testing.T) {
+	f := newFakeRincon(t)
+	f.add(Service{Name: "orders", Version: "1.0.0", Endpoint: "http://orders:8080"})
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	client := newTestClient(t, f, Config{SnapshotPath: path})
+
+	snapshot := client.currentSnapshot()
+	if snapshot == nil || len(snapshot.Services) != 2 {
+		t.Fatalf("snapshot = %+v, want both services", snapshot)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"name": "orders"`) {
+		t.Fatalf("snapshot file is missing orders:\n%s", data)
+	}
+}
+
+func TestNewClientFallsBackToSnapshot(t *testing.T) {
+	f := newFakeRincon(t)
+	f.add(Service{Name: "orders", Version: "1.0.0", Endpoint: "http://orders:8080"})
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	newTestClient(t, f, Config{SnapshotPath: path})
+
+	f.down.Store(true)
+	client := newTestClient(t, f, Config{SnapshotPath: path})
+	services, err := client.GetServicesByName("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || !services[0].Stale {
+		t.Fatalf("services = %+v, want one stale instance", services)
+	}
+}
+
+func TestCanceledRequestDoesNotFallBackToSnapshot(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	err := client.LoadSnapshot(strings.NewReader(`{
+		"services": [{"id": 7, "name": "orders", "endpoint": "http://orders:8080"}],
+		"routes": [{"route": "/orders/**", "method": "GET", "service_name": "orders"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if services, err := client.GetServicesByNameContext(ctx, "orders"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetServicesByNameContext = %+v, %v; want context.Canceled", services, err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if service, err := client.LookupRoute(ctx, "/orders/1", "GET"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("LookupRoute = %+v, %v; want context.DeadlineExceeded", service, err)
+	}
+}
+
+func TestNewClientWithoutSnapshotFailsWhenUnreachable(t *testing.T) {
+	f := newFakeRincon(t)
+	f.down.Store(true)
+	if _, err := NewClient(Config{BaseURL: f.URL}); err == nil {
+		t.Fatal("expected an error without a snapshot to fall back to")
+	}
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	if _, err := client.MatchRouteLocal("/orders/1", "GET"); err == nil {
+		t.Fatal("MatchRouteLocal without a snapshot: expected an error")
+	}
+
+	err := client.LoadSnapshot(strings.NewReader(`{
+		"services": [{"id": 7, "name": "orders", "endpoint": "http://orders:8080"}],
+		"routes": [{"route": "/orders/**", "method": "GET", "service_name": "orders"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err := client.MatchRouteLocal("/orders/1", "GET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.ID != 7 {
+		t.Fatalf("matched service %d, want 7", service.ID)
+	}
+	if _, err := client.MatchRouteLocal("/orders/1", "DELETE"); err == nil {
+		t.Fatal("DELETE /orders/1: expected no match")
+	}
+	if err := client.LoadSnapshot(strings.NewReader("{")); err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+}
+
+func TestCloseStopsSnapshotRefresh(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{SnapshotInterval: 1})
+	if got := f.count("GET /rincon/routes"); got != 1 {
+		t.Fatalf("got %d snapshots on startup, want 1", got)
+	}
+	client.Close()
+	client.Close()
+
+	time.Sleep(1500 * time.Millisecond)
+	if got := f.count("GET /rincon/routes"); got != 1 {
+		t.Fatalf("snapshot refreshed %d times after Close", got-1)
+	}
+}
@@ -0,0 +1,233 @@
+package rincon
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceParentHeader and TraceStateHeader are the W3C Trace Context headers.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// TraceContext identifies a span as defined by the W3C Trace Context
+// specification.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+	// State is the vendor specific tracestate, passed on unchanged.
+	State string
+}
+
+// IsValid reports whether the trace and span IDs are set.
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != [16]byte{} && tc.SpanID != [8]byte{}
+}
+
+// String returns the traceparent header value of the trace context.
+func (tc TraceContext) String() string {
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(tc.TraceID[:]), hex.EncodeToString(tc.SpanID[:]), tc.Flags)
+}
+
+// ParseTraceParent parses a traceparent header value.
+func ParseTraceParent(value string) (TraceContext, error) {
+	var tc TraceContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return tc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return tc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != 16 {
+		return tc, fmt.Errorf("invalid trace ID in traceparent %q", value)
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != 8 {
+		return tc, fmt.Errorf("invalid span ID in traceparent %q", value)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return tc, fmt.Errorf("invalid flags in traceparent %q", value)
+	}
+	copy(tc.TraceID[:], traceID)
+	copy(tc.SpanID[:], spanID)
+	tc.Flags = flags[0]
+	if !tc.IsValid() {
+		return tc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	return tc, nil
+}
+
+// TraceFromRequest returns the trace context of the traceparent and
+// tracestate headers of the request.
+func TraceFromRequest(r *http.Request) (TraceContext, bool) {
+	tc, err := ParseTraceParent(r.Header.Get(TraceParentHeader))
+	if err != nil {
+		return TraceContext{}, false
+	}
+	tc.State = r.Header.Get(TraceStateHeader)
+	return tc, true
+}
+
+type traceContextKey struct{}
+
+// ContextWithTrace returns a copy of ctx carrying the trace context, which
+// becomes the parent of the spans of the requests made with it.
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceFromContext returns the trace context carried by ctx.
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok && tc.IsValid()
+}
+
+// SpanEvent is a point in time during a span, such as the connection
+// being established.
+type SpanEvent struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+}
+
+// Span is a request made by the client: a call to the Rincon API, or an
+// attempt to send a request to a service instance through a Transport or
+// the Gateway. Its events are the httptrace timings of the request, named
+// dns_start, dns_done, connect_start, connect_done, tls_start, tls_done,
+// wrote_request and first_byte.
+type Span struct {
+	Name         string            `json:"name"`
+	Trace        TraceContext      `json:"-"`
+	ParentSpanID [8]byte           `json:"-"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Events       []SpanEvent       `json:"events,omitempty"`
+	// Status is the response status, or zero if the request failed.
+	Status int   `json:"status"`
+	Err    error `json:"-"`
+
+	mu sync.Mutex
+}
+
+func (s *Span) event(name string) {
+	s.mu.Lock()
+	s.Events = append(s.Events, SpanEvent{Name: name, Time: time.Now()})
+	s.mu.Unlock()
+}
+
+// Tracer receives the spans of the requests made by a Client. Its methods
+// are called synchronously and must not block.
+type Tracer interface {
+	// StartSpan is called before the request is sent.
+	StartSpan(span *Span)
+	// EndSpan is called once the response headers have arrived or the
+	// request failed, with End, Events, Status and Err filled in.
+	EndSpan(span *Span)
+}
+
+type nopTracer struct{}
+
+func (nopTracer) StartSpan(*Span) {}
+func (nopTracer) EndSpan(*Span)   {}
+
+// startSpan starts a span for the request, as a child of the trace context
+// of its context or, failing that, of its traceparent header. The span's
+// trace context is set as the request's traceparent, and its httptrace
+// timings are recorded as events. It returns the request to send.
+func (c *Client) startSpan(req *http.Request, name string, attributes map[string]string) (*Span, *http.Request) {
+	parent, ok := TraceFromContext(req.Context())
+	if !ok {
+		parent, ok = TraceFromRequest(req)
+	}
+	span := &Span{Name: name, Attributes: attributes, Start: time.Now()}
+	if ok {
+		span.Trace = parent
+		span.ParentSpanID = parent.SpanID
+	} else {
+		rand.Read(span.Trace.TraceID[:])
+		span.Trace.Flags = 0x01
+	}
+	rand.Read(span.Trace.SpanID[:])
+
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { span.event("dns_start") },
+		DNSDone:              func(httptrace.DNSDoneInfo) { span.event("dns_done") },
+		ConnectStart:         func(string, string) { span.event("connect_start") },
+		ConnectDone:          func(string, string, error) { span.event("connect_done") },
+		TLSHandshakeStart:    func() { span.event("tls_start") },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { span.event("tls_done") },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { span.event("wrote_request") },
+		GotFirstResponseByte: func() { span.event("first_byte") },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set(TraceParentHeader, span.Trace.String())
+	if span.Trace.State != "" {
+		req.Header.Set(TraceStateHeader, span.Trace.State)
+	} else {
+		req.Header.Del(TraceStateHeader)
+	}
+	c.tracer.StartSpan(span)
+	return span, req
+}
+
+// endSpan completes the span with the outcome of its request.
+func (c *Client) endSpan(span *Span, status int, err error) {
+	span.mu.Lock()
+	span.End = time.Now()
+	span.Status = status
+	span.Err = err
+	span.mu.Unlock()
+	c.tracer.EndSpan(span)
+}
+
+// TraceRecorder is a Tracer that keeps the spans in memory, for use in
+// tests.
+type TraceRecorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// NewTraceRecorder returns an empty TraceRecorder.
+func NewTraceRecorder() *TraceRecorder {
+	return &TraceRecorder{}
+}
+
+// StartSpan implements Tracer.
+func (r *TraceRecorder) StartSpan(span *Span) {}
+
+// EndSpan implements Tracer.
+func (r *TraceRecorder) EndSpan(span *Span) {
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+}
+
+// Spans returns the ended spans in the order they ended.
+func (r *TraceRecorder) Spans() []*Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Span(nil), r.spans...)
+}
+
+// Reset discards the recorded spans.
+func (r *TraceRecorder) Reset() {
+	r.mu.Lock()
+	r.spans = nil
+	r.mu.Unlock()
+}
@@ -0,0 +1,133 @@
+package rincon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceParent(t *testing.T) {
+	tc, err := ParseTraceParent(testTraceParent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.String() != testTraceParent || tc.Flags != 0x01 {
+		t.Fatalf("round trip = %s, flags %x", tc, tc.Flags)
+	}
+	if _, err := ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future"); err != nil {
+		t.Fatalf("future version with extra fields: %s", err)
+	}
+	for _, invalid := range []string{
+		"",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+	} {
+		if _, err := ParseTraceParent(invalid); err == nil {
+			t.Errorf("ParseTraceParent(%q): expected an error", invalid)
+		}
+	}
+}
+
+func TestRinconRequestSpans(t *testing.T) {
+	f := newFakeRincon(t)
+	recorder := NewTraceRecorder()
+	client := newTestClient(t, f, Config{Tracer: recorder})
+	recorder.Reset()
+
+	parent, _ := ParseTraceParent(testTraceParent)
+	parent.State = "vendor=1"
+	ctx := ContextWithTrace(context.Background(), parent)
+	if _, err := client.GetServicesByNameContext(ctx, "rincon"); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /rincon/services/{name}" || span.Status != http.StatusOK {
+		t.Fatalf("span %q with status %d", span.Name, span.Status)
+	}
+	if span.Trace.TraceID != parent.TraceID || span.ParentSpanID != parent.SpanID || span.Trace.SpanID == parent.SpanID {
+		t.Fatalf("span %s is not a child of %s", span.Trace, parent)
+	}
+	header := f.header("GET /rincon/services/rincon")
+	if header.Get(TraceParentHeader) != span.Trace.String() || header.Get(TraceStateHeader) != "vendor=1" {
+		t.Fatalf("sent traceparent %q and tracestate %q, want %q and vendor=1", header.Get(TraceParentHeader), header.Get(TraceStateHeader), span.Trace)
+	}
+	events := make(map[string]bool)
+	for _, event := range span.Events {
+		events[event.Name] = true
+	}
+	if !events["wrote_request"] || !events["first_byte"] {
+		t.Fatalf("events = %v, want wrote_request and first_byte", span.Events)
+	}
+}
+
+func TestPickServiceContextPassesContext(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.PickServiceContext(ctx, "rincon", ""); err == nil {
+		t.Fatal("expected the canceled context to fail the lookup")
+	}
+	if _, err := client.PickServiceContext(context.Background(), "rincon", ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransportPropagatesTrace(t *testing.T) {
+	f := newFakeRincon(t)
+	var mu sync.Mutex
+	var received http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = r.Header.Clone()
+		mu.Unlock()
+	}))
+	defer backend.Close()
+	f.add(Service{Name: "orders", Version: "1.0.0", Endpoint: backend.URL})
+	recorder := NewTraceRecorder()
+	client := newTestClient(t, f, Config{Tracer: recorder})
+	recorder.Reset()
+
+	req, _ := http.NewRequest(http.MethodGet, "rincon://orders/items", nil)
+	req.Header.Set(TraceParentHeader, testTraceParent)
+	resp, err := (&http.Client{Transport: NewTransport(client)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	var attempt *Span
+	for _, span := range recorder.Spans() {
+		if span.Name == "GET orders" {
+			attempt = span
+		}
+	}
+	if attempt == nil {
+		t.Fatalf("no span for the request to orders in %d spans", len(recorder.Spans()))
+	}
+	parent, _ := ParseTraceParent(testTraceParent)
+	if attempt.Trace.TraceID != parent.TraceID || attempt.ParentSpanID != parent.SpanID {
+		t.Fatalf("span %s is not a child of the request's traceparent", attempt.Trace)
+	}
+	if attempt.Attributes["service"] != "orders" || attempt.Attributes["endpoint"] != backend.URL {
+		t.Fatalf("attributes = %v", attempt.Attributes)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := received.Get(TraceParentHeader); got != attempt.Trace.String() {
+		t.Fatalf("backend received traceparent %q, want %q", got, attempt.Trace)
+	}
+}
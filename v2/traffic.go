@@ -0,0 +1,210 @@
+package rincon
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// TrafficSplit sends a share of a service's traffic to the instances whose
+// Version satisfies a constraint.
+type TrafficSplit struct {
+	// Version is a version constraint, such as "2.x" or ">=2.3 <3".
+	Version string `json:"version"`
+	// Weight is the share of traffic relative to the other splits of
+	// the same service.
+	Weight int `json:"weight"`
+}
+
+// TrafficPolicy maps service names to the splits of their traffic between
+// versions. For example, {"orders": {{"2.x", 5}, {"1.x", 95}}} sends 5% of
+// the traffic for orders to version 2 and the rest to version 1.
+type TrafficPolicy map[string][]TrafficSplit
+
+// LoadTrafficPolicy reads a JSON encoded TrafficPolicy from r.
+func LoadTrafficPolicy(r io.Reader) (TrafficPolicy, error) {
+	policy := TrafficPolicy{}
+	if err := json.NewDecoder(r).Decode(&policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// TrafficStat is the number of requests a WeightedBalancer sent to the
+// instances of a split.
+type TrafficStat struct {
+	Service  string `json:"service"`
+	Version  string `json:"version"`
+	Requests uint64 `json:"requests"`
+}
+
+// WeightedBalancer is a Balancer that splits the traffic of each service
+// between versions according to a TrafficPolicy. Requests with a key are
+// assigned to the same split for as long as the policy does not change,
+// and requests without a key are assigned randomly. Within a split, the
+// instance is picked by the fallback Balancer, which is also used for
+// services without a policy. If a split has no matching instances, the
+// request is sent to the other splits instead.
+type WeightedBalancer struct {
+	fallback Balancer
+	policy   atomic.Pointer[compiledPolicy]
+
+	mu    sync.Mutex
+	stats map[[2]string]*atomic.Uint64
+}
+
+type compiledPolicy map[string][]compiledSplit
+
+type compiledSplit struct {
+	TrafficSplit
+	constraint Constraint
+}
+
+// NewWeightedBalancer returns a WeightedBalancer with the given policy.
+// If fallback is nil, a NewestVersionBalancer is used.
+func NewWeightedBalancer(policy TrafficPolicy, fallback Balancer) (*WeightedBalancer, error) {
+	if fallback == nil {
+		fallback = &NewestVersionBalancer{}
+	}
+	b := &WeightedBalancer{
+		fallback: fallback,
+		stats:    make(map[[2]string]*atomic.Uint64),
+	}
+	if err := b.SetPolicy(policy); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// SetPolicy replaces the traffic policy. It can be called at any time to
+// reload the policy, and returns an error without changing the current
+// policy if a split is invalid.
+func (b *WeightedBalancer) SetPolicy(policy TrafficPolicy) error {
+	compiled := make(compiledPolicy, len(policy))
+	for service, splits := range policy {
+		for _, split := range splits {
+			if split.Weight < 0 {
+				return fmt.Errorf("invalid traffic split for %s: negative weight %d", service, split.Weight)
+			}
+			constraint, err := ParseConstraint(split.Version)
+			if err != nil {
+				return fmt.Errorf("invalid traffic split for %s: %w", service, err)
+			}
+			compiled[service] = append(compiled[service], compiledSplit{TrafficSplit: split, constraint: constraint})
+		}
+	}
+	b.policy.Store(&compiled)
+	return nil
+}
+
+// Policy returns the current traffic policy.
+func (b *WeightedBalancer) Policy() TrafficPolicy {
+	compiled := *b.policy.Load()
+	policy := make(TrafficPolicy, len(compiled))
+	for service, splits := range compiled {
+		for _, split := range splits {
+			policy[service] = append(policy[service], split.TrafficSplit)
+		}
+	}
+	return policy
+}
+
+// Pick implements Balancer.
+func (b *WeightedBalancer) Pick(instances []Service, key string) (*Service, error) {
+	service, count, err := b.pick(instances, key)
+	if err == nil {
+		count()
+	}
+	return service, err
+}
+
+// pick is like Pick, but returns a function that counts the pick in Stats
+// instead of counting it, so that the client counts only the instances it
+// actually sends a request to.
+func (b *WeightedBalancer) pick(instances []Service, key string) (*Service, func(), error) {
+	if len(instances) == 0 {
+		return nil, nil, ErrNoInstances
+	}
+	name := instances[0].Name
+	splits := (*b.policy.Load())[name]
+	total := 0
+	for _, split := range splits {
+		total += split.Weight
+	}
+	if total == 0 {
+		return uncounted(b.fallback.Pick(instances, key))
+	}
+
+	var bucket int
+	if key != "" {
+		h := fnv.New32a()
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		bucket = int(h.Sum32() % uint32(total))
+	} else {
+		bucket = rand.Intn(total)
+	}
+	chosen := 0
+	for i, split := range splits {
+		if bucket < split.Weight {
+			chosen = i
+			break
+		}
+		bucket -= split.Weight
+	}
+
+	// Try the chosen split first, then the others in order.
+	for offset := 0; offset < len(splits); offset++ {
+		split := splits[(chosen+offset)%len(splits)]
+		if split.Weight == 0 {
+			continue
+		}
+		matching := split.constraint.FilterServices(instances)
+		if len(matching) == 0 {
+			continue
+		}
+		service, err := b.fallback.Pick(matching, key)
+		return service, func() { b.count(name, split.Version) }, err
+	}
+	return uncounted(b.fallback.Pick(instances, key))
+}
+
+func uncounted(service *Service, err error) (*Service, func(), error) {
+	return service, func() {}, err
+}
+
+func (b *WeightedBalancer) count(service, version string) {
+	id := [2]string{service, version}
+	b.mu.Lock()
+	counter, ok := b.stats[id]
+	if !ok {
+		counter = new(atomic.Uint64)
+		b.stats[id] = counter
+	}
+	b.mu.Unlock()
+	counter.Add(1)
+}
+
+// Stats returns the number of requests sent to each split since the
+// balancer was created, sorted by service and version.
+func (b *WeightedBalancer) Stats() []TrafficStat {
+	b.mu.Lock()
+	stats := make([]TrafficStat, 0, len(b.stats))
+	for id, counter := range b.stats {
+		stats = append(stats, TrafficStat{Service: id[0], Version: id[1], Requests: counter.Load()})
+	}
+	b.mu.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Service != stats[j].Service {
+			return stats[i].Service < stats[j].Service
+		}
+		return stats[i].Version < stats[j].Version
+	})
+	return stats
+}
@@ -0,0 +1,115 @@
+package rincon
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var canaryInstances = []Service{
+	{ID: 1, Name: "orders", Version: "1.4.0"},
+	{ID: 2, Name: "orders", Version: "1.4.0"},
+	{ID: 3, Name: "orders", Version: "2.0.0"},
+}
+
+func TestWeightedBalancerDistribution(t *testing.T) {
+	b, err := NewWeightedBalancer(TrafficPolicy{"orders": {{"2.x", 20}, {"1.x", 80}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const requests = 10000
+	versions := make(map[string]int)
+	for i := 0; i < requests; i++ {
+		service, err := b.Pick(canaryInstances, "user-"+strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions[service.Version]++
+	}
+	if share := float64(versions["2.0.0"]) / requests; math.Abs(share-0.2) > 0.03 {
+		t.Fatalf("canary share = %.3f, want 0.2", share)
+	}
+	stats := b.Stats()
+	if len(stats) != 2 || stats[0].Version != "1.x" || stats[1].Version != "2.x" ||
+		stats[0].Requests+stats[1].Requests != requests || stats[1].Requests != uint64(versions["2.0.0"]) {
+		t.Fatalf("Stats = %+v, want the picks per split", stats)
+	}
+}
+
+func TestWeightedBalancerCountsOnlyUsedPicks(t *testing.T) {
+	b, err := NewWeightedBalancer(TrafficPolicy{"orders": {{"2.x", 100}, {"1.x", 0}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{Balancer: b, BreakerFailureRate: 0.5, BreakerMinRequests: 1})
+	client.recordResult(canaryInstances[2], 500, nil)
+
+	service, err := client.pickInstance(canaryInstances, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.Version != "1.4.0" {
+		t.Fatalf("picked %s, want 1.4.0 while the breaker of the canary is open", service.Version)
+	}
+	if stats := b.Stats(); len(stats) != 0 {
+		t.Fatalf("Stats = %+v, want no pick counted for the canary's open breaker", stats)
+	}
+}
+
+func TestWeightedBalancerStickyKeys(t *testing.T) {
+	b, _ := NewWeightedBalancer(TrafficPolicy{"orders": {{"2.x", 50}, {"1.x", 50}}}, nil)
+	for i := 0; i < 100; i++ {
+		key := "user-" + strconv.Itoa(i)
+		first, _ := b.Pick(canaryInstances, key)
+		for j := 0; j < 5; j++ {
+			again, _ := b.Pick(canaryInstances, key)
+			if again.Version != first.Version {
+				t.Fatalf("key %s moved from %s to %s", key, first.Version, again.Version)
+			}
+		}
+	}
+}
+
+func TestWeightedBalancerFallsBackToOtherSplits(t *testing.T) {
+	b, _ := NewWeightedBalancer(TrafficPolicy{"orders": {{"3.x", 100}, {"1.x", 0}, {"2.x", 1}}}, nil)
+	for i := 0; i < 20; i++ {
+		service, err := b.Pick(canaryInstances, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if service.Version != "2.0.0" {
+			t.Fatalf("picked %s, want the 2.x split since 3.x has no instances and 1.x has no weight", service.Version)
+		}
+	}
+
+	users := []Service{{ID: 4, Name: "users", Version: "1.0.0"}}
+	if service, err := b.Pick(users, ""); err != nil || service.ID != 4 {
+		t.Fatalf("service without a policy: got %v, %v", service, err)
+	}
+}
+
+func TestWeightedBalancerSetPolicy(t *testing.T) {
+	b, _ := NewWeightedBalancer(TrafficPolicy{"orders": {{"2.x", 100}}}, nil)
+	if err := b.SetPolicy(TrafficPolicy{"orders": {{"1.x", -1}}}); err == nil {
+		t.Fatal("negative weight: expected an error")
+	}
+	if err := b.SetPolicy(TrafficPolicy{"orders": {{">=>1", 1}}}); err == nil {
+		t.Fatal("invalid constraint: expected an error")
+	}
+	if policy := b.Policy(); len(policy["orders"]) != 1 || policy["orders"][0].Version != "2.x" {
+		t.Fatalf("Policy = %v, want the previous policy after a failed SetPolicy", policy)
+	}
+
+	policy, err := LoadTrafficPolicy(strings.NewReader(`{"orders": [{"version": "1.x", "weight": 1}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	if service, _ := b.Pick(canaryInstances, "key"); service.Version != "1.4.0" {
+		t.Fatalf("picked %s after reloading the policy, want 1.4.0", service.Version)
+	}
+}
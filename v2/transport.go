@@ -0,0 +1,141 @@
+package rincon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Transport is an http.RoundTripper that sends requests for URLs of the
+// form rincon://<service>/<path> to an instance of the named service. The
+// instance is picked by the client's Balancer, skipping instances ejected
+// by the health prober or whose circuit breaker is open, and the outcome
+// of the request is counted by the instance's circuit breaker. Requests
+// that match a RequestPolicy are hedged and retried on other instances.
+// The request carries a traceparent header for its span, which is a child
+// of the trace context of the request's context or traceparent header.
+// Requests over the ServiceLimit of the service wait or fail with a
+// *LimitError. Requests for other URLs are sent unchanged through the Base
+// transport.
+type Transport struct {
+	// Base is the transport used to send the requests. If it is nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+	// KeyHeader is the request header whose value is passed to the
+	// Balancer as the request key.
+	KeyHeader string
+
+	client *Client
+}
+
+// NewTransport returns a Transport that resolves services using the given
+// client.
+func NewTransport(client *Client) *Transport {
+	return &Transport{client: client}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "rincon" {
+		return t.base().RoundTrip(req)
+	}
+	name := req.URL.Hostname()
+	instances, err := t.client.lookupInstances(req.Context(), name)
+	if err != nil {
+		return nil, err
+	}
+	key := ""
+	if t.KeyHeader != "" {
+		key = req.Header.Get(t.KeyHeader)
+	}
+	return t.client.limitedRoundTrip(t.base(), req, name, instances, key)
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// parseEndpoint parses the Endpoint of the service, which must be an
+// absolute URL.
+func parseEndpoint(service Service) (*url.URL, error) {
+	target, err := url.Parse(service.Endpoint)
+	if err != nil || target.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint for %s: %q", service.Name, service.Endpoint)
+	}
+	return target, nil
+}
+
+// lookupInstances returns the instances of the named service from the
+// current snapshot, or from Rincon if no snapshot is loaded.
+func (c *Client) lookupInstances(ctx context.Context, name string) ([]Service, error) {
+	if instances := c.localServices(name); len(instances) > 0 {
+		c.instrumentation.SnapshotLookup(name, true)
+		return instances, nil
+	}
+	c.instrumentation.SnapshotLookup(name, false)
+	return c.getServicesByName(ctx, name)
+}
+
+// Call sends a request with a JSON encoded body to the path on an instance
+// of the named service through the client's Transport, and decodes the
+// JSON response into v. The path may include a query string, and the body
+// and v may be nil. Responses with a status outside of 2xx are returned as
+// an error.
+func (c *Client) Call(ctx context.Context, service, method, path string, body, v interface{}) error {
+	var buf io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		buf = bytes.NewReader(data)
+	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+	u := &url.URL{
+		Scheme:   "rincon",
+		Host:     service,
+		Path:     "/" + strings.TrimPrefix(ref.Path, "/"),
+		RawQuery: ref.RawQuery,
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), buf)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.currentUserAgent())
+
+	resp, err := c.callClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respError := &ErrorResponse{StatusCode: resp.StatusCode}
+		if json.Unmarshal(data, respError) != nil || respError.Message == "" {
+			respError.Message = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("[%d] %s", respError.StatusCode, respError.Message)
+	}
+	if v != nil && len(data) > 0 {
+		return json.Unmarshal(data, v)
+	}
+	return nil
+}
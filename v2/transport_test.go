@@ -0,0 +1,85 @@
+package rincon
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newEchoService registers a backend as the "orders" service that responds
+// with the path and query of each request, or with 404 under /missing.
+func newEchoService(t *testing.T, f *fakeRincon) {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "no such order"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"query":  r.URL.RawQuery,
+		})
+	}))
+	t.Cleanup(backend.Close)
+	f.add(Service{Name: "orders", Version: "1.0.0", Endpoint: backend.URL})
+}
+
+func TestCall(t *testing.T) {
+	f := newFakeRincon(t)
+	newEchoService(t, f)
+	client := newTestClient(t, f, Config{})
+
+	tests := []struct {
+		path  string
+		want  string
+		query string
+	}{
+		{"/items", "/items", ""},
+		{"items/7", "/items/7", ""},
+		{"/items?id=7&q=a%20b", "/items", "id=7&q=a%20b"},
+	}
+	for _, tt := range tests {
+		var got map[string]string
+		if err := client.Call(context.Background(), "orders", "GET", tt.path, nil, &got); err != nil {
+			t.Fatalf("Call(%q): %s", tt.path, err)
+		}
+		if got["path"] != tt.want || got["query"] != tt.query {
+			t.Errorf("Call(%q) sent path %q and query %q, want %q and %q", tt.path, got["path"], got["query"], tt.want, tt.query)
+		}
+	}
+
+	err := client.Call(context.Background(), "orders", "GET", "/missing", nil, nil)
+	if err == nil || err.Error() != "[404] no such order" {
+		t.Fatalf("err = %v, want [404] no such order", err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	f := newFakeRincon(t)
+	newEchoService(t, f)
+	client := newTestClient(t, f, Config{})
+	httpClient := &http.Client{Transport: NewTransport(client)}
+
+	resp, err := httpClient.Post("rincon://orders/items?id=7", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	var got map[string]string
+	json.Unmarshal(body, &got)
+	if got["method"] != "POST" || got["path"] != "/items" || got["query"] != "id=7" {
+		t.Fatalf("got %s", body)
+	}
+
+	if _, err := httpClient.Get("rincon://users/"); err == nil {
+		t.Fatal("expected an error for a service without instances")
+	}
+}
@@ -0,0 +1,378 @@
+package rincon
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed semantic version.
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	PreRelease []string
+	Build      string
+}
+
+// ParseVersion parses a semantic version such as "2.3.1-beta.1+abc".
+// A leading "v" is allowed, and a missing minor or patch number is
+// treated as zero, so "v2" and "2.3" are valid.
+func ParseVersion(s string) (Version, error) {
+	original := s
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	var v Version
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		v.Build = s[i+1:]
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		if s[i+1:] == "" {
+			return Version{}, fmt.Errorf("invalid version %q: empty pre-release", original)
+		}
+		v.PreRelease = strings.Split(s[i+1:], ".")
+		for _, identifier := range v.PreRelease {
+			if identifier == "" {
+				return Version{}, fmt.Errorf("invalid version %q: empty pre-release identifier", original)
+			}
+		}
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q: too many components", original)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", original)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+// String returns the version without a leading "v", such as "2.3.1-beta.1".
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.PreRelease) > 0 {
+		s += "-" + strings.Join(v.PreRelease, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 if v is older than, equal to or newer than
+// other, following semantic versioning precedence. A pre-release version
+// is older than the same version without one, and build metadata is
+// ignored.
+func (v Version) Compare(other Version) int {
+	for _, pair := range [][2]int{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(v.PreRelease) == 0 && len(other.PreRelease) == 0:
+		return 0
+	case len(v.PreRelease) == 0:
+		return 1
+	case len(other.PreRelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.PreRelease) && i < len(other.PreRelease); i++ {
+		if c := comparePreRelease(v.PreRelease[i], other.PreRelease[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.PreRelease) < len(other.PreRelease):
+		return -1
+	case len(v.PreRelease) > len(other.PreRelease):
+		return 1
+	}
+	return 0
+}
+
+// comparePreRelease compares two pre-release identifiers. Numeric
+// identifiers compare numerically and are older than alphanumeric ones.
+func comparePreRelease(a, b string) int {
+	an, aErr := strconv.Atoi(a)
+	bn, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		if an != bn {
+			if an < bn {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Constraint is a set of version ranges, such as ">=2.3 <3 || ^4.1".
+// Comparators separated by spaces or commas must all be satisfied, and
+// ranges separated by "||" are alternatives. A version without an operator
+// that ends in a wildcard or omits components, such as "2.x" or "2.3",
+// matches every version starting with the given components.
+//
+// The supported operators are =, !=, >, >=, <, <=, ~ (same minor version)
+// and ^ (same major version, or the first non-zero component). Partial
+// versions are expanded by their number of components for every operator,
+// so "<=2.3" means "<2.4.0-0", "~2" means ">=2.0.0 <3.0.0-0" and "^0"
+// means ">=0.0.0 <1.0.0-0". A pre-release version only satisfies a range
+// that has a comparator with a pre-release on the same major, minor and
+// patch version.
+type Constraint struct {
+	ranges [][]comparator
+	text   string
+}
+
+// comparator compares a version with a bound. The "outside" operator is
+// satisfied by versions below version or at or above upper.
+type comparator struct {
+	op      string
+	version Version
+	upper   Version
+}
+
+// ParseConstraint parses a version constraint.
+func ParseConstraint(s string) (Constraint, error) {
+	constraint := Constraint{text: strings.TrimSpace(s)}
+	for _, group := range strings.Split(s, "||") {
+		fields := strings.FieldsFunc(group, func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+		if len(fields) == 0 {
+			return Constraint{}, fmt.Errorf("invalid constraint %q: empty range", s)
+		}
+		var comparators []comparator
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			op := field[:len(field)-len(strings.TrimLeft(field, "=!<>~^"))]
+			rest := field[len(op):]
+			if rest == "" && i+1 < len(fields) {
+				i++
+				rest = fields[i]
+			}
+			switch op {
+			case "", "=", "==", "!=", ">", ">=", "<", "<=", "~", "^":
+			default:
+				return Constraint{}, fmt.Errorf("invalid constraint %q: unknown operator %q", s, op)
+			}
+			version, components, err := parsePartialVersion(rest)
+			if err != nil {
+				return Constraint{}, fmt.Errorf("invalid constraint %q: %w", s, err)
+			}
+			comparators = append(comparators, expand(op, version, components)...)
+		}
+		constraint.ranges = append(constraint.ranges, comparators)
+	}
+	return constraint, nil
+}
+
+// parsePartialVersion parses a version that may end in an "x" or "*"
+// wildcard or omit components, such as "2.x" or "2.3", and returns the
+// number of components that were given.
+func parsePartialVersion(s string) (Version, int, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	components := 0
+	for _, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+		components++
+	}
+	if components == 0 {
+		return Version{}, 0, nil
+	}
+	if components < len(parts) {
+		s = strings.Join(parts[:components], ".")
+	} else if strings.ContainsAny(parts[len(parts)-1], "-+") {
+		components = 3
+	}
+	v, err := ParseVersion(s)
+	return v, components, err
+}
+
+// expand returns the comparators of the operator applied to a version
+// with the given number of components. Partial versions, "~" and "^" are
+// expanded into lower and upper bounds, where an upper bound excludes the
+// pre-releases of the first version past the range.
+func expand(op string, v Version, components int) []comparator {
+	if components == 0 {
+		switch op {
+		case "!=", ">", "<":
+			return []comparator{{op: "<", version: preReleaseZero(Version{})}}
+		}
+		return []comparator{{op: ">=", version: Version{}}}
+	}
+	partial := components < 3
+	// next is the first version that does not start with the given
+	// components.
+	next := bump(v, components)
+	switch op {
+	case "", "=", "==":
+		if partial {
+			return []comparator{{op: ">=", version: v}, {op: "<", version: preReleaseZero(next)}}
+		}
+		return []comparator{{op: "=", version: v}}
+	case "!=":
+		if partial {
+			return []comparator{{op: "outside", version: v, upper: preReleaseZero(next)}}
+		}
+	case ">":
+		if partial {
+			return []comparator{{op: ">=", version: next}}
+		}
+	case "<":
+		if partial {
+			return []comparator{{op: "<", version: preReleaseZero(v)}}
+		}
+	case "<=":
+		if partial {
+			return []comparator{{op: "<", version: preReleaseZero(next)}}
+		}
+	case "~":
+		upper := bump(v, 2)
+		if components == 1 {
+			upper = bump(v, 1)
+		}
+		return []comparator{{op: ">=", version: v}, {op: "<", version: preReleaseZero(upper)}}
+	case "^":
+		var upper Version
+		switch {
+		case v.Major > 0 || components == 1:
+			upper = bump(v, 1)
+		case v.Minor > 0 || components == 2:
+			upper = bump(v, 2)
+		default:
+			upper = bump(v, 3)
+		}
+		return []comparator{{op: ">=", version: v}, {op: "<", version: preReleaseZero(upper)}}
+	}
+	return []comparator{{op: op, version: v}}
+}
+
+// bump returns the version after v that increments the last of the given
+// number of components, such as 2.4.0 for 2.3.1 and two components.
+func bump(v Version, components int) Version {
+	switch components {
+	case 1:
+		return Version{Major: v.Major + 1}
+	case 2:
+		return Version{Major: v.Major, Minor: v.Minor + 1}
+	}
+	return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+}
+
+// preReleaseZero returns v with the lowest pre-release, so that an upper
+// bound of 3.0.0-0 excludes 3.0.0 and all of its pre-releases.
+func preReleaseZero(v Version) Version {
+	v.PreRelease = []string{"0"}
+	return v
+}
+
+// String returns the constraint as it was parsed.
+func (c Constraint) String() string {
+	return c.text
+}
+
+// Check reports whether the version satisfies the constraint.
+func (c Constraint) Check(v Version) bool {
+	for _, comparators := range c.ranges {
+		if satisfiesRange(comparators, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func satisfiesRange(comparators []comparator, v Version) bool {
+	preReleaseAllowed := len(v.PreRelease) == 0
+	for _, cmp := range comparators {
+		if !cmp.check(v) {
+			return false
+		}
+		if len(cmp.version.PreRelease) > 0 && cmp.version.Major == v.Major &&
+			cmp.version.Minor == v.Minor && cmp.version.Patch == v.Patch {
+			preReleaseAllowed = true
+		}
+	}
+	return preReleaseAllowed
+}
+
+func (cmp comparator) check(v Version) bool {
+	c := v.Compare(cmp.version)
+	switch cmp.op {
+	case "", "=", "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case "outside":
+		return c < 0 || v.Compare(cmp.upper) >= 0
+	}
+	return false
+}
+
+// FilterServices returns the services whose Version satisfies the
+// constraint, newest first. Services with an invalid version are dropped.
+func (c Constraint) FilterServices(services []Service) []Service {
+	filtered := make([]Service, 0, len(services))
+	for _, service := range services {
+		v, err := ParseVersion(service.Version)
+		if err == nil && c.Check(v) {
+			filtered = append(filtered, service)
+		}
+	}
+	SortServicesByVersion(filtered)
+	return filtered
+}
+
+// SortServicesByVersion sorts services newest version first. Services with
+// an invalid version are sorted last, and the order of services with equal
+// versions is preserved.
+func SortServicesByVersion(services []Service) {
+	versions := make(map[string]*Version)
+	for _, service := range services {
+		if _, ok := versions[service.Version]; ok {
+			continue
+		}
+		if v, err := ParseVersion(service.Version); err == nil {
+			versions[service.Version] = &v
+		} else {
+			versions[service.Version] = nil
+		}
+	}
+	sort.SliceStable(services, func(i, j int) bool {
+		vi, vj := versions[services[i].Version], versions[services[j].Version]
+		switch {
+		case vi == nil:
+			return false
+		case vj == nil:
+			return true
+		}
+		return vi.Compare(*vj) > 0
+	})
+}
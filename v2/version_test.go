@@ -0,0 +1,187 @@
+package rincon
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"2.3.1", "2.3.1", true},
+		{"v2", "2.0.0", true},
+		{"2.3", "2.3.0", true},
+		{"2.3.1-beta.1+abc", "2.3.1-beta.1+abc", true},
+		{"2.3.1-", "", false},
+		{"2.3.1-beta..1", "", false},
+		{"1.2.3.4", "", false},
+		{"2.x", "", false},
+		{"-1.0.0", "", false},
+	}
+	for _, tt := range tests {
+		v, err := ParseVersion(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseVersion(%q) error = %v, want ok %v", tt.in, err, tt.ok)
+			continue
+		}
+		if tt.ok && v.String() != tt.want {
+			t.Errorf("ParseVersion(%q) = %s, want %s", tt.in, v, tt.want)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	ordered := []string{
+		"1.0.0-0",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.1.0",
+		"2.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a, _ := ParseVersion(ordered[i])
+			b, _ := ParseVersion(ordered[j])
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := a.Compare(b); got != want {
+				t.Errorf("%s.Compare(%s) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+	a, _ := ParseVersion("1.0.0+build.1")
+	b, _ := ParseVersion("1.0.0+build.2")
+	if a.Compare(b) != 0 {
+		t.Error("build metadata must not affect precedence")
+	}
+}
+
+func TestParseConstraintExpansion(t *testing.T) {
+	tests := map[string]string{
+		"2.3":      ">=2.3.0 <2.4.0-0",
+		"=2":       ">=2.0.0 <3.0.0-0",
+		"2.3.1":    "=2.3.1",
+		"*":        ">=0.0.0",
+		"<=2.3":    "<2.4.0-0",
+		"<=2.3.1":  "<=2.3.1",
+		"<2.3":     "<2.3.0-0",
+		">2.3":     ">=2.4.0",
+		">2":       ">=3.0.0",
+		">=2.3":    ">=2.3.0",
+		"!=2.3":    "outside 2.3.0 2.4.0-0",
+		"~2":       ">=2.0.0 <3.0.0-0",
+		"~2.3":     ">=2.3.0 <2.4.0-0",
+		"~2.3.4":   ">=2.3.4 <2.4.0-0",
+		"^0":       ">=0.0.0 <1.0.0-0",
+		"^0.0":     ">=0.0.0 <0.1.0-0",
+		"^0.3":     ">=0.3.0 <0.4.0-0",
+		"^0.0.3":   ">=0.0.3 <0.0.4-0",
+		"^2":       ">=2.0.0 <3.0.0-0",
+		"^2.3.1":   ">=2.3.1 <3.0.0-0",
+		"~ 2.x":    ">=2.0.0 <3.0.0-0",
+		">= 2.3.x": ">=2.3.0",
+	}
+	for in, want := range tests {
+		c, err := ParseConstraint(in)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q): %s", in, err)
+			continue
+		}
+		var parts []string
+		for _, cmp := range c.ranges[0] {
+			if cmp.op == "outside" {
+				parts = append(parts, "outside "+cmp.version.String()+" "+cmp.upper.String())
+				continue
+			}
+			parts = append(parts, cmp.op+cmp.version.String())
+		}
+		if got := strings.Join(parts, " "); got != want {
+			t.Errorf("ParseConstraint(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestConstraintCheck(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"<=2.3", "2.3.9", true},
+		{"<=2.3", "2.4.0", false},
+		{"<=2.3", "2.4.0-beta", false},
+		{"<2.3", "2.2.9", true},
+		{"<2.3", "2.3.0", false},
+		{">2.3", "2.3.9", false},
+		{">2.3", "2.4.0", true},
+		{"!=2.3", "2.3.5", false},
+		{"!=2.3", "2.4.0", true},
+		{"!=2.3", "2.2.0", true},
+		{"~2", "2.9.0", true},
+		{"~2", "3.0.0", false},
+		{"~2", "3.0.0-alpha", false},
+		{"^0", "0.9.0", true},
+		{"^0", "1.0.0", false},
+		{"^0.3", "0.3.9", true},
+		{"^0.3", "0.4.0", false},
+		{"^2.3", "2.9.9", true},
+		{"^2.3", "2.2.0", false},
+		{">=2.3 <3 || ^4.1", "4.5.0", true},
+		{">=2.3 <3 || ^4.1", "3.5.0", false},
+		{">=2.3, <3", "2.5.0", true},
+		{"2.x", "2.0.0-beta", false},
+		{">=2.0.0-beta", "2.0.0-rc.1", true},
+		{">=2.0.0-beta", "2.1.0-rc.1", false},
+		{">*", "1.0.0", false},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatalf("ParseConstraint(%q): %s", tt.constraint, err)
+		}
+		v, _ := ParseVersion(tt.version)
+		if got := c.Check(v); got != tt.want {
+			t.Errorf("%q.Check(%s) = %v, want %v", tt.constraint, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParseConstraintErrors(t *testing.T) {
+	for _, in := range []string{"", ">=2 ||", "=>2", ">=two", "~2.3.4.5"} {
+		if _, err := ParseConstraint(in); err == nil {
+			t.Errorf("ParseConstraint(%q): expected an error", in)
+		}
+	}
+}
+
+func TestFilterServices(t *testing.T) {
+	services := []Service{
+		{ID: 1, Version: "2.3.0"},
+		{ID: 2, Version: "3.0.0"},
+		{ID: 3, Version: "2.10.1"},
+		{ID: 4, Version: "latest"},
+		{ID: 5, Version: "2.3.0"},
+	}
+	c, _ := ParseConstraint("^2")
+	filtered := c.FilterServices(services)
+	var ids []int
+	for _, service := range filtered {
+		ids = append(ids, service.ID)
+	}
+	if len(ids) != 3 || ids[0] != 3 || ids[1] != 1 || ids[2] != 5 {
+		t.Fatalf("FilterServices = %v, want [3 1 5]", ids)
+	}
+}
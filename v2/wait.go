@@ -0,0 +1,150 @@
+package rincon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	waitInitialBackoff = 500 * time.Millisecond
+	waitMaxBackoff     = 30 * time.Second
+	healthProbeTimeout = 5 * time.Second
+)
+
+// WaitForServices blocks until every named service has at least one
+// registered instance, retrying with exponential backoff. If the client
+// was created with WaitForHealthy, an instance is only counted once its
+// HealthCheck responds with a 2xx status. Progress is reported through
+// the client's Logger. It returns the context's error if the context is
+// done before all services are available.
+func (c *Client) WaitForServices(ctx context.Context, names ...string) error {
+	return c.waitFor(ctx, func() (string, bool) {
+		missing := c.missingServices(ctx, names)
+		if len(missing) == 0 {
+			return "", true
+		}
+		return fmt.Sprintf("services %v", missing), false
+	})
+}
+
+// WaitForRoute blocks until Rincon matches the route and method to a
+// service, retrying with exponential backoff. If the client was created
+// with WaitForHealthy, the matched service must also be healthy.
+func (c *Client) WaitForRoute(ctx context.Context, route, method string) error {
+	return c.waitFor(ctx, func() (string, bool) {
+		service, err := c.LookupRoute(ctx, route, method)
+		if err != nil || service == nil {
+			return fmt.Sprintf("route %s %s", method, route), false
+		}
+		if c.waitForHealthy && !c.serviceHealthy(ctx, *service) {
+			return fmt.Sprintf("route %s %s (%s is unhealthy)", method, route, service.Name), false
+		}
+		return "", true
+	})
+}
+
+// waitFor calls ready until it returns true, logging what is still
+// missing before each retry.
+func (c *Client) waitFor(ctx context.Context, ready func() (string, bool)) error {
+	backoff := waitInitialBackoff
+	for attempt := 1; ; attempt++ {
+		missing, ok := ready()
+		if ok {
+			if attempt > 1 {
+				c.logger.Printf("dependencies available after %d attempts", attempt)
+			}
+			return nil
+		}
+		// Sleep between half and all of the backoff, so that restarting
+		// services do not retry in lockstep.
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		c.logger.Printf("waiting for %s, retrying in %s", missing, delay.Round(time.Millisecond))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("still waiting for %s: %w", missing, ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > waitMaxBackoff {
+			backoff = waitMaxBackoff
+		}
+	}
+}
+
+// missingServices returns the names without an available instance.
+func (c *Client) missingServices(ctx context.Context, names []string) []string {
+	missing := make([]string, 0)
+	for _, name := range names {
+		instances, err := c.GetServicesByNameContext(ctx, name)
+		if err != nil {
+			missing = append(missing, name)
+			continue
+		}
+		available := false
+		for _, instance := range instances {
+			if !c.waitForHealthy || c.serviceHealthy(ctx, instance) {
+				available = true
+				break
+			}
+		}
+		if !available {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// serviceHealthy reports whether the service's HealthCheck responds with
+// a 2xx status. Services without a HealthCheck are considered healthy.
+func (c *Client) serviceHealthy(ctx context.Context, service Service) bool {
+	if service.HealthCheck == "" {
+		return true
+	}
+	status, err := c.checkHealth(ctx, service)
+	if err != nil {
+		return false
+	}
+	return status >= 200 && status < 300
+}
+
+// ReadinessHandler returns an http.Handler to serve as the service's
+// readiness probe. It responds with 503 Service Unavailable and the list of
+// missing services until every named service has a registered instance,
+// after which it responds with 200 OK. Once ready, the dependencies are not
+// checked again. While the client is draining, the handler responds with
+// 503 Service Unavailable.
+func (c *Client) ReadinessHandler(names ...string) http.Handler {
+	var ready atomic.Bool
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if c.IsDraining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "draining",
+			})
+			return
+		}
+		if !ready.Load() {
+			missing := c.missingServices(r.Context(), names)
+			if len(missing) > 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"message": "waiting for dependencies",
+					"missing": missing,
+				})
+				return
+			}
+			ready.Store(true)
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "ready",
+		})
+	})
+}
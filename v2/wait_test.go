@@ -0,0 +1,100 @@
+package rincon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitForServices(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		f.add(Service{Name: "orders", Endpoint: "http://orders:8080"})
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.WaitForServices(ctx, "rincon", "orders"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForServicesContextDone(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := client.WaitForServices(ctx, "orders")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWaitForHealthyServices(t *testing.T) {
+	var healthy atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+	f := newFakeRincon(t)
+	f.add(Service{Name: "orders", Endpoint: backend.URL, HealthCheck: backend.URL + "/health"})
+	client := newTestClient(t, f, Config{WaitForHealthy: true})
+
+	if missing := client.missingServices(context.Background(), []string{"orders"}); len(missing) != 1 {
+		t.Fatalf("missing = %v, want the unhealthy orders service", missing)
+	}
+	healthy.Store(true)
+	if missing := client.missingServices(context.Background(), []string{"orders"}); len(missing) != 0 {
+		t.Fatalf("missing = %v, want none once healthy", missing)
+	}
+}
+
+func TestWaitForRoute(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	owner := newTestClient(t, f, Config{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		owner.Register(Service{Name: "orders", Endpoint: "http://orders:8080"}, []Route{{Route: "/orders/**", Method: "*"}})
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.WaitForRoute(ctx, "/orders/1", "GET"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadinessHandler(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	handler := client.ReadinessHandler("orders")
+	status := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return rec.Code
+	}
+
+	if got := status(); got != http.StatusServiceUnavailable {
+		t.Fatalf("status without orders = %d, want 503", got)
+	}
+	orders := f.add(Service{Name: "orders", Endpoint: "http://orders:8080"})
+	if got := status(); got != http.StatusOK {
+		t.Fatalf("status with orders = %d, want 200", got)
+	}
+	// Once ready, the dependencies are not checked again.
+	f.drop(orders.ID)
+	if got := status(); got != http.StatusOK {
+		t.Fatalf("status after orders left = %d, want 200", got)
+	}
+	client.draining.Store(true)
+	if got := status(); got != http.StatusServiceUnavailable {
+		t.Fatalf("status while draining = %d, want 503", got)
+	}
+}
@@ -0,0 +1,153 @@
+package rincon
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RinconProbeHeader marks a health check request as a Rincon probe.
+// Requests whose User-Agent starts with "rincon" are also counted as
+// Rincon probes.
+const RinconProbeHeader = "X-Rincon-Probe"
+
+// isRinconProbe reports whether a health check request was sent by Rincon,
+// as opposed to a load balancer or a liveness probe.
+func isRinconProbe(r *http.Request) bool {
+	return r.Header.Get(RinconProbeHeader) != "" || strings.HasPrefix(strings.ToLower(r.UserAgent()), "rincon")
+}
+
+// HealthHandler returns an http.Handler to serve at the service's
+// HealthCheck endpoint. Requests from Rincon are recorded as probes,
+// which the heartbeat watchdog uses in server heartbeat mode, while other
+// health checks, such as liveness probes, are answered without being
+// recorded. While the client is draining, the handler responds with 503
+// Service Unavailable.
+func (c *Client) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if c.IsDraining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "draining",
+			})
+			return
+		}
+		if isRinconProbe(r) {
+			c.RecordProbe()
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "ok",
+		})
+	})
+}
+
+// RecordProbe records that Rincon has probed the service's health check.
+// It only needs to be called directly by services that serve their own
+// health check handler instead of HealthHandler.
+func (c *Client) RecordProbe() {
+	c.probeMu.Lock()
+	c.lastProbe = time.Now()
+	c.probeMu.Unlock()
+	c.recordHeartbeat(nil)
+}
+
+// LastProbe returns the time of the last recorded Rincon probe.
+// It is the zero time if no probe has been recorded.
+func (c *Client) LastProbe() time.Time {
+	c.probeMu.Lock()
+	defer c.probeMu.Unlock()
+	return c.lastProbe
+}
+
+// startWatchdog starts the server heartbeat watchdog if it is not
+// already running. The watchdog counts registration as the first probe.
+func (c *Client) startWatchdog() {
+	c.probeMu.Lock()
+	defer c.probeMu.Unlock()
+	if c.watchdogStop != nil || c.heartbeatInterval <= 0 {
+		return
+	}
+	c.lastProbe = time.Now()
+	c.watchdogStop = make(chan struct{})
+	go c.runWatchdog(c.watchdogStop)
+}
+
+// stopWatchdog stops the server heartbeat watchdog if it is running.
+func (c *Client) stopWatchdog() {
+	c.probeMu.Lock()
+	defer c.probeMu.Unlock()
+	if c.watchdogStop == nil {
+		return
+	}
+	close(c.watchdogStop)
+	c.watchdogStop = nil
+}
+
+// watchdogExited clears the watchdog started with the given stop channel,
+// so that the next registration starts a new one.
+func (c *Client) watchdogExited(stop chan struct{}) {
+	c.probeMu.Lock()
+	defer c.probeMu.Unlock()
+	if c.watchdogStop == stop {
+		c.watchdogStop = nil
+	}
+}
+
+// runWatchdog checks once per heartbeat interval whether Rincon has probed
+// the service within the missed threshold. If it has not, the client
+// re-registers and the OnHeartbeatMissed callback is fired. Missed probes
+// are expected while the client is Disconnected, and the client
+// re-registers with its routes on the first check after it reconnects
+// instead.
+func (c *Client) runWatchdog(stop chan struct{}) {
+	interval := time.Duration(c.heartbeatInterval) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer c.watchdogExited(stop)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if c.reconnected.Load() && c.State() != Disconnected {
+				service := c.Service()
+				if service == nil || c.IsDraining() {
+					return
+				}
+				if _, err := c.reregister(*service); err != nil {
+					c.logger.Printf("re-registration failed: %s", err)
+					continue
+				}
+				c.probeMu.Lock()
+				c.lastProbe = time.Now()
+				c.probeMu.Unlock()
+				continue
+			}
+			lastProbe := c.LastProbe()
+			if time.Since(lastProbe) < interval*time.Duration(c.heartbeatMissedThreshold) {
+				continue
+			}
+			if c.State() == Disconnected {
+				continue
+			}
+			c.recordHeartbeat(ErrHeartbeatMissed)
+			c.logger.Printf("no heartbeat from rincon since %s, re-registering", lastProbe.Format(time.RFC3339))
+			service := c.Service()
+			if service == nil || c.IsDraining() {
+				return
+			}
+			_, err := c.reregister(*service)
+			if err != nil {
+				c.logger.Printf("re-registration failed: %s", err)
+			}
+			c.probeMu.Lock()
+			c.lastProbe = time.Now()
+			c.probeMu.Unlock()
+			if c.onHeartbeatMissed != nil {
+				c.onHeartbeatMissed(lastProbe, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package rincon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWatchdogReregistersWhenProbesStop(t *testing.T) {
+	f := newFakeRincon(t)
+	missed := make(chan error, 1)
+	client := newTestClient(t, f, Config{
+		HeartbeatMode:            ServerHeartbeat,
+		HeartbeatInterval:        1,
+		HeartbeatMissedThreshold: 1,
+		OnHeartbeatMissed: func(lastProbe time.Time, err error) {
+			select {
+			case missed <- err:
+			default:
+			}
+		},
+	})
+	id, err := client.Register(Service{Name: "watched", Endpoint: "http://localhost:9000"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.stopWatchdog()
+	f.drop(id)
+
+	select {
+	case err := <-missed:
+		if err != nil {
+			t.Fatalf("re-registration failed: %s", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("OnHeartbeatMissed was not called")
+	}
+	if instances := f.instances("watched"); len(instances) != 1 {
+		t.Fatalf("got %d instances after re-registration, want 1", len(instances))
+	}
+}
+
+func TestWatchdogRestartsAfterExiting(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{
+		HeartbeatMode:            ServerHeartbeat,
+		HeartbeatInterval:        1,
+		HeartbeatMissedThreshold: 1,
+	})
+	service := Service{Name: "watched", Endpoint: "http://localhost:9000"}
+	if _, err := client.Register(service, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer client.stopWatchdog()
+
+	// A draining client's watchdog exits on the next missed probe.
+	client.draining.Store(true)
+	running := func() bool {
+		client.probeMu.Lock()
+		defer client.probeMu.Unlock()
+		return client.watchdogStop != nil
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for running() {
+		if time.Now().After(deadline) {
+			t.Fatal("watchdog did not exit")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := client.Register(service, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !running() {
+		t.Fatal("watchdog was not restarted by Register")
+	}
+}
+
+func TestHealthHandlerRecordsRinconProbesOnly(t *testing.T) {
+	f := newFakeRincon(t)
+	client := newTestClient(t, f, Config{})
+	handler := client.HealthHandler()
+
+	tests := []struct {
+		name   string
+		header http.Header
+		probe  bool
+	}{
+		{"liveness probe", http.Header{"User-Agent": {"kube-probe/1.30"}}, false},
+		{"no user agent", http.Header{}, false},
+		{"rincon user agent", http.Header{"User-Agent": {"Rincon/2.1.0"}}, true},
+		{"probe header", http.Header{RinconProbeHeader: {"1"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := client.LastProbe()
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			req.Header = tt.header
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			if recorded := client.LastProbe() != before; recorded != tt.probe {
+				t.Fatalf("probe recorded = %v, want %v", recorded, tt.probe)
+			}
+		})
+	}
+}